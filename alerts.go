@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAlertsInterval = 30
+
+// AlertRule define one watched condition
+type AlertRule struct {
+	// Kind of condition: temp, disk, load, mpd_error, mpd_down
+	Kind string
+	// Path is mount point checked by "disk" rule
+	Path string
+	// Threshold raising alert
+	Threshold float64
+	// Hysteresis - alert is recovered when value fall to Threshold-Hysteresis;
+	// ignored for mpd_error and mpd_down
+	Hysteresis float64
+	// Duration in seconds condition must last before alert is raised
+	Duration int
+	// Message show when alert is raised; "{value}" is replaced by current value
+	Message string
+	// RecoveredMessage show when condition is over; optional
+	RecoveredMessage string
+
+	active bool
+	since  time.Time
+}
+
+func (a *AlertRule) value() (float64, error) {
+	switch a.Kind {
+	case "temp":
+		return CPUTemperature()
+	case "disk":
+		path := a.Path
+		if path == "" {
+			path = "/"
+		}
+		used, _, err := DiskUsage(path)
+		return float64(used), err
+	case "load":
+		return loadAvgValue()
+	case "mpd_error":
+		st := player.Status()
+		defer st.Free()
+		if st.Error != "" {
+			return 1, nil
+		}
+		return 0, nil
+	case "mpd_down":
+		if err := player.Ping(); err != nil {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, nil
+}
+
+// boolean check is value of rule 0 or 1
+func (a *AlertRule) boolean() bool {
+	return a.Kind == "mpd_error" || a.Kind == "mpd_down"
+}
+
+func (a *AlertRule) threshold() float64 {
+	if a.boolean() {
+		return 0.5
+	}
+	return a.Threshold
+}
+
+// recoverThreshold return value below which active alert is recovered;
+// hysteresis is ignored for boolean kinds
+func (a *AlertRule) recoverThreshold() float64 {
+	if a.boolean() {
+		return a.threshold()
+	}
+	return a.Threshold - a.Hysteresis
+}
+
+func (a *AlertRule) format(msg string, value float64) string {
+	if msg == "" {
+		msg = a.Kind + " alert: {value}"
+	}
+	return strings.Replace(msg, "{value}", strconv.FormatFloat(value, 'f', -1, 64), -1)
+}
+
+// check rule and return message to display (if any)
+func (a *AlertRule) check(now time.Time) string {
+	value, err := a.value()
+	if err != nil {
+		logger.Errorf("AlertRule.check %s error: %v", a.Kind, err)
+		return ""
+	}
+
+	threshold := a.threshold()
+	if !a.active {
+		if value <= threshold {
+			a.since = time.Time{}
+			return ""
+		}
+		if a.since.IsZero() {
+			a.since = now
+		}
+		if now.Sub(a.since) < time.Duration(a.Duration)*time.Second {
+			return ""
+		}
+		a.active = true
+		logger.Infof("AlertRule.check %s raised: %v", a.Kind, value)
+		return a.format(a.Message, value)
+	}
+
+	if value <= a.recoverThreshold() {
+		a.active = false
+		a.since = time.Time{}
+		logger.Infof("AlertRule.check %s recovered: %v", a.Kind, value)
+		if a.RecoveredMessage != "" {
+			return a.format(a.RecoveredMessage, value)
+		}
+	}
+	return ""
+}
+
+// Alerts periodically check configured rules and send messages on changes
+type Alerts struct {
+	Message chan string
+	end     chan bool
+}
+
+// NewAlerts create and start alerts watcher
+func NewAlerts() *Alerts {
+	a := &Alerts{
+		Message: make(chan string, 5),
+		end:     make(chan bool),
+	}
+	if len(configuration.AlertsConf.Rules) > 0 {
+		go a.run()
+	}
+	return a
+}
+
+func (a *Alerts) run() {
+	interval := configuration.AlertsConf.Interval
+	if interval <= 0 {
+		interval = defaultAlertsInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	logger.Infof("Alerts.run: watching %d rules", len(configuration.AlertsConf.Rules))
+
+	for {
+		select {
+		case <-a.end:
+			logger.Info("Alerts.run: end")
+			return
+		case now := <-ticker.C:
+			for _, rule := range configuration.AlertsConf.Rules {
+				if msg := rule.check(now); msg != "" {
+					select {
+					case a.Message <- msg:
+					case <-a.end:
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Close alerts watcher
+func (a *Alerts) Close() {
+	close(a.end)
+}
+
+func loadAvgValue() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	if i := bytes.IndexByte(data, ' '); i > 0 {
+		data = data[:i]
+	}
+	return strconv.ParseFloat(string(data), 64)
+}
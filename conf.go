@@ -14,6 +14,12 @@ type (
 	KeysConf struct {
 		ToggleLCD string `toml:"toggle_lcd"`
 
+		// Digits are keys for numbers 0-9 (default KEY_0..KEY_9)
+		Digits []string
+		// DigitsTimeout is time in seconds after which entered number is
+		// accepted without confirmation
+		DigitsTimeout int
+
 		Menu struct {
 			Show   string
 			Back   string
@@ -22,6 +28,13 @@ type (
 			Select string
 			Up10   string
 			Down10 string
+			// NextLetter jump to next item starting with other letter
+			NextLetter string
+			// Filter open filter screen for current list
+			Filter string
+			// Left and Right move cursor in text input
+			Left  string
+			Right string
 		}
 		MPD struct {
 			Play    string
@@ -34,13 +47,43 @@ type (
 			VolMute string
 			Repeat  string
 			Random  string
+			Consume string
+			Single  string
+			// Sleep cycle sleep timer
+			Sleep string
+		}
+		Radio struct {
+			// Stations show stations list
+			Stations string
+			// Presets are optional keys playing stations 1..n directly
+			Presets []string
 		}
 	}
 
 	// MPDConf keep configuration parameters related do mpd
 	MPDConf struct {
-		// Host is mpd server address
+		// Host is mpd server address; used when no Servers are defined
 		Host string
+		// Servers is list of named mpd servers; first is used on start
+		Servers []*MPDServer
+		// Follow switch to playing server when active one is not playing
+		Follow bool
+		// FollowInterval is interval in seconds between checking servers
+		FollowInterval int
+	}
+
+	// PlayerConf select controlled player
+	PlayerConf struct {
+		// Kind of player: mpd (default) or mpv
+		Kind string
+	}
+
+	// MPVConf keep configuration of mpv player
+	MPVConf struct {
+		// Socket is path to mpv json ipc socket (--input-ipc-server)
+		Socket string
+		// PlaylistsDir is directory with playlists files
+		PlaylistsDir string
 	}
 
 	// DisplayConf keep hardware configuration for lcd display
@@ -55,12 +98,83 @@ type (
 		GpioD6          uint8
 		GpioD7          uint8
 		GpioBl          uint8
+		// IdleTimeout is number of minutes of inactivity (no keys, mpd not
+		// playing) after which backlight is turned off; 0 = never (except
+		// night mode)
+		IdleTimeout int
+		// NightStart and NightEnd ("HH:MM") define night mode; backlight is
+		// turned off at NightStart and only urgent messages and toggle_lcd key
+		// turn it on; other keys are ignored while backlight is off
+		NightStart string
+		NightEnd   string
+
+		// night period parsed on load; minutes since midnight
+		nightMode            bool
+		nightStart, nightEnd int
 	}
 
 	// ServicesConf store internal web/tcp servers configuration
 	ServicesConf struct {
 		HTTPServerAddr string `toml:"http_server_addr"`
 		TCPServerAddr  string `toml:"tcp_server_addr"`
+		// HTTPUser and HTTPPassword enable basic authentication
+		HTTPUser     string `toml:"http_user"`
+		HTTPPassword string `toml:"http_password"`
+		// HTTPToken enable bearer token authentication
+		HTTPToken string `toml:"http_token"`
+		// TCPToken must be send in first line of message to tcp server
+		TCPToken string `toml:"tcp_token"`
+		// TLSCert and TLSKey enable https
+		TLSCert string `toml:"tls_cert"`
+		TLSKey  string `toml:"tls_key"`
+		// TCPTLS use tls certificate also for tcp server
+		TCPTLS bool `toml:"tcp_tls"`
+		// AllowedIPs limit clients of http and tcp servers to given
+		// addresses or networks
+		AllowedIPs []string `toml:"allowed_ips"`
+		// Pprof enable /debug/pprof handlers
+		Pprof bool `toml:"pprof"`
+		// ControlSocket is path of unix socket for control commands
+		ControlSocket string `toml:"control_socket"`
+		// ControlSocketMode is octal file mode of socket (ie. "0660")
+		ControlSocketMode string `toml:"control_socket_mode"`
+		// ControlSocketGroup is group owning socket
+		ControlSocketGroup string `toml:"control_socket_group"`
+	}
+
+	// MQTTConf configure mqtt client
+	MQTTConf struct {
+		// Broker address, ie. "tcp://localhost:1883"; empty disable mqtt
+		Broker   string
+		ClientID string `toml:"client_id"`
+		Username string
+		Password string
+		// Topic is prefix of all topics; default "rpilcd"
+		Topic string
+		// Discovery enable Home Assistant mqtt discovery
+		Discovery       bool
+		DiscoveryPrefix string
+	}
+
+	// MPRISConf configure MPRIS D-Bus service
+	MPRISConf struct {
+		// Bus is "session" or "system"; empty disable mpris
+		Bus string
+		// Name is suffix of bus name (org.mpris.MediaPlayer2.<name>)
+		Name string
+	}
+
+	// LoggingConf configure logging
+	LoggingConf struct {
+		// Level is "silent", "error", "info" or "debug"
+		Level string
+		// Format is "text" (default), "kv" (key=value) or "json"
+		Format string
+		// Output is "stdout" (default) or "journal"
+		Output string
+		// Levels define log levels for subsystems (mpd, mpv, lcd, lirc,
+		// screen)
+		Levels map[string]string
 	}
 
 	// LircConf store information about Lirc configuration
@@ -68,20 +182,114 @@ type (
 		PidFile string
 		Remote  string
 	}
+
+	// AlertsConf configure conditions watched by rpilcd
+	AlertsConf struct {
+		// Interval between checks in seconds
+		Interval int
+		Rules    []*AlertRule
+	}
+
+	// LogWatchConf configure journal and log files watching
+	LogWatchConf struct {
+		Rules []*LogWatchRule
+	}
+
+	// TimersConf configure sleep timer and alarms
+	TimersConf struct {
+		// StateFile keep timers state between restarts
+		StateFile string
+		// SleepMode is "stop" or "fade"
+		SleepMode string
+		// FadeTime is time of fade out in seconds
+		FadeTime int
+		// SleepSteps are sleep timer values (in minutes) cycled by key
+		SleepSteps []int
+		Alarms     []*AlarmConf
+	}
+
+	// SchedulerConf configure scheduled jobs
+	SchedulerConf struct {
+		// StateFile keep jobs enabled/disabled in menu between restarts
+		StateFile string
+		Jobs      []*JobConf
+	}
+
+	// ScriptsConf configure lua scripts
+	ScriptsConf struct {
+		// Dir is directory with scripts (*.lua)
+		Dir string
+		// ReloadInterval is interval of checking scripts for changes in
+		// seconds; <0 disable reloading
+		ReloadInterval int
+	}
+
+	// HistoryConf configure played songs log
+	HistoryConf struct {
+		// File is JSONL file with played songs; empty = disabled
+		File string
+	}
 )
 
 // Configuration is top configuration object
 type Configuration struct {
-	Menu         *MenuItem
-	Keys         KeysConf
-	MPDConf      MPDConf      `toml:"mpd"`
-	DisplayConf  DisplayConf  `toml:"display"`
-	ServicesConf ServicesConf `toml:"services"`
-	LircConf     LircConf     `toml:"lirc"`
+	Menu          *MenuItem
+	Keys          KeysConf
+	PlayerConf    PlayerConf    `toml:"player"`
+	MPDConf       MPDConf       `toml:"mpd"`
+	MPVConf       MPVConf       `toml:"mpv"`
+	DisplayConf   DisplayConf   `toml:"display"`
+	ServicesConf  ServicesConf  `toml:"services"`
+	LircConf      LircConf      `toml:"lirc"`
+	AlertsConf    AlertsConf    `toml:"alerts"`
+	LogWatchConf  LogWatchConf  `toml:"logwatch"`
+	TimersConf    TimersConf    `toml:"timers"`
+	SchedulerConf SchedulerConf `toml:"scheduler"`
+	ScriptsConf   ScriptsConf   `toml:"scripts"`
+	HistoryConf   HistoryConf   `toml:"history"`
+	MQTTConf      MQTTConf      `toml:"mqtt"`
+	MPRISConf     MPRISConf     `toml:"mpris"`
+	LoggingConf   LoggingConf   `toml:"logging"`
+	Stations      []*Station
+	Macros        []*MacroConf
+
+	// keyNames is set of keys defined in configuration
+	keyNames map[string]bool
 }
 
 var configuration *Configuration
 
+// collectKeyNames build set of all keys defined in configuration, including
+// digits and macro keys
+func (c *Configuration) collectKeyNames() {
+	k := &c.Keys
+	names := []string{k.ToggleLCD,
+		k.Menu.Show, k.Menu.Back, k.Menu.Up, k.Menu.Down, k.Menu.Select,
+		k.Menu.Up10, k.Menu.Down10, k.Menu.NextLetter, k.Menu.Filter,
+		k.Menu.Left, k.Menu.Right,
+		k.MPD.Play, k.MPD.Stop, k.MPD.Pause, k.MPD.Next, k.MPD.Prev,
+		k.MPD.VolUp, k.MPD.VolDown, k.MPD.VolMute, k.MPD.Repeat,
+		k.MPD.Random, k.MPD.Consume, k.MPD.Single, k.MPD.Sleep,
+		k.Radio.Stations,
+	}
+	names = append(names, k.Radio.Presets...)
+	if len(k.Digits) > 0 {
+		names = append(names, k.Digits...)
+	} else {
+		names = append(names, defaultDigitKeys...)
+	}
+	for _, mc := range c.Macros {
+		names = append(names, mc.Key)
+	}
+
+	c.keyNames = make(map[string]bool)
+	for _, name := range names {
+		if name != "" {
+			c.keyNames[name] = true
+		}
+	}
+}
+
 func loadConfiguration() error {
 	f, err := os.Open(*confFileName)
 	if err != nil {
@@ -102,6 +310,27 @@ func loadConfiguration() error {
 	if err := toml.Unmarshal(buf, conf); err != nil {
 		return err
 	}
+	if err := conf.parseNightMode(); err != nil {
+		return err
+	}
+	conf.collectKeyNames()
 	configuration = conf
 	return nil
 }
+
+// parseNightMode parse night mode period; night mode is enabled when both
+// night_start and night_end are set
+func (c *Configuration) parseNightMode() (err error) {
+	dc := &c.DisplayConf
+	if dc.NightStart == "" || dc.NightEnd == "" {
+		return nil
+	}
+	if dc.nightStart, err = parseDayTime(dc.NightStart); err != nil {
+		return err
+	}
+	if dc.nightEnd, err = parseDayTime(dc.NightEnd); err != nil {
+		return err
+	}
+	dc.nightMode = true
+	return nil
+}
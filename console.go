@@ -11,13 +11,16 @@ const (
 
 // Console simulate lcd without physical lcd
 type Console struct {
-	active bool
+	active    bool
+	cursorCol int
+	cursorRow int
 }
 
 // NewConsole create and init new console output
 func NewConsole() (l *Console) {
 	l = &Console{
-		active: true,
+		active:    true,
+		cursorCol: -1,
 	}
 	return l
 }
@@ -29,26 +32,42 @@ func (l *Console) Display(msg string) {
 
 // Close console
 func (l *Console) Close() {
-	logger.Infof("Console close")
+	lcdLog.Infof("Console close")
 	l.active = false
 }
 
 func (l *Console) display(text string) {
 	if l.active {
 		for i, l := range strings.Split(text, "\n") {
-			logger.Printf("SimpleDisplay: [%d] '%s'", i, l)
+			lcdLog.Printf("SimpleDisplay: [%d] '%s'", i, l)
 			time.Sleep(consoleDelay)
 		}
 	} else {
-		logger.Infof("SimpleDisplay: not active")
+		lcdLog.Infof("SimpleDisplay: not active")
 	}
 }
 
 func (l *Console) ToggleBacklight() {
-	logger.Printf("SimpleDisplay: toggle backlight")
+	lcdLog.Printf("SimpleDisplay: toggle backlight")
 	l.active = !l.active
 }
 
+func (l *Console) SetBacklight(on bool) {
+	if l.active != on {
+		l.ToggleBacklight()
+	}
+}
+
 func (l *Console) Active() bool {
 	return l.active
 }
+
+func (l *Console) SetCursor(col, row int) {
+	if col == l.cursorCol && row == l.cursorRow {
+		return
+	}
+	l.cursorCol, l.cursorRow = col, row
+	if col >= 0 {
+		lcdLog.Printf("SimpleDisplay: cursor at %d,%d", col, row)
+	}
+}
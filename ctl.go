@@ -0,0 +1,395 @@
+package main
+
+// Control service on unix socket and `rpilcd ctl` client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ctlTimeout = 5 * time.Second
+
+// CtlRequest is one command received by control socket
+type CtlRequest struct {
+	Cmd  string
+	Args string
+	// Result receive response line
+	Result chan string
+}
+
+// CtlServer is local service listening on unix socket for commands
+type CtlServer struct {
+	Path     string
+	Mode     string
+	Group    string
+	Requests chan *CtlRequest
+
+	ln net.Listener
+}
+
+// Start listening on socket
+func (s *CtlServer) Start() error {
+	logger.Infof("CtlServer.Start starting (%s)...", s.Path)
+
+	// remove stale socket
+	if _, err := os.Stat(s.Path); err == nil {
+		os.Remove(s.Path)
+	}
+
+	ln, err := net.Listen("unix", s.Path)
+	if err != nil {
+		logger.Error("CtlServer.Start Listen error: ", err.Error())
+		return err
+	}
+	s.ln = ln
+
+	if s.Mode != "" {
+		if mode, err := strconv.ParseUint(s.Mode, 8, 32); err == nil {
+			if err := os.Chmod(s.Path, os.FileMode(mode)); err != nil {
+				logger.Error("CtlServer.Start chmod error: ", err.Error())
+			}
+		} else {
+			logger.Errorf("CtlServer.Start invalid mode '%s'", s.Mode)
+		}
+	}
+	if s.Group != "" {
+		if grp, err := user.LookupGroup(s.Group); err == nil {
+			gid, _ := strconv.Atoi(grp.Gid)
+			if err := os.Chown(s.Path, -1, gid); err != nil {
+				logger.Error("CtlServer.Start chown error: ", err.Error())
+			}
+		} else {
+			logger.Error("CtlServer.Start group error: ", err.Error())
+		}
+	}
+
+	s.Requests = make(chan *CtlRequest)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				logger.Info("CtlServer: accept finished: ", err.Error())
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return nil
+}
+
+func (s *CtlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		req := &CtlRequest{Result: make(chan string, 1)}
+		fields := strings.SplitN(line, " ", 2)
+		req.Cmd = fields[0]
+		if len(fields) > 1 {
+			req.Args = strings.TrimSpace(fields[1])
+		}
+		logger.Debugf("CtlServer: request %s '%s'", req.Cmd, req.Args)
+
+		var res string
+		select {
+		case s.Requests <- req:
+			select {
+			case res = <-req.Result:
+			case <-time.After(ctlTimeout):
+				res = "ERR timeout"
+			}
+		case <-time.After(ctlTimeout):
+			res = "ERR timeout"
+		}
+		if _, err := fmt.Fprintln(conn, res); err != nil {
+			return
+		}
+	}
+}
+
+// Close socket
+func (s *CtlServer) Close() {
+	if s.ln != nil {
+		s.ln.Close()
+		os.Remove(s.Path)
+	}
+}
+
+// ctlResult format response line
+func ctlResult(res string, err error) string {
+	if err != nil {
+		return "ERR " + err.Error()
+	}
+	res = strings.Replace(res, "\n", "\\n", -1)
+	if res == "" {
+		return "OK"
+	}
+	return "OK " + res
+}
+
+// Control execute request from control socket
+func (d *ScreenMgr) Control(req *CtlRequest) string {
+	switch req.Cmd {
+	case "key":
+		if req.Args == "" {
+			return ctlResult("", errors.New("missing key"))
+		}
+		metricsKeyEvents.WithLabelValues("ctl", metricsKeyLabel(req.Args)).Inc()
+		d.NewCommand(req.Args)
+		return ctlResult("", nil)
+	case "msg":
+		if req.Args == "" {
+			return ctlResult("", errors.New("missing message"))
+		}
+		d.AddUrgentMsg(strings.Replace(req.Args, "\\n", "\n", -1))
+		return ctlResult("", nil)
+	case "status":
+		st := player.Status()
+		defer st.Free()
+		return ctlResult(fmt.Sprintf("state=%s volume=%s flags=%s song=%s",
+			st.Status, st.Volume, st.Flags, st.CurrentSong), nil)
+	case "volume":
+		vol, err := strconv.Atoi(req.Args)
+		if err != nil || vol < 0 || vol > 100 {
+			return ctlResult("", errors.New("invalid volume"))
+		}
+		player.SetVolume(vol)
+		return ctlResult("", nil)
+	case "player":
+		switch req.Args {
+		case "play":
+			player.Play(-1)
+		case "pause":
+			player.Pause()
+		case "stop":
+			player.Stop()
+		case "next":
+			player.Next()
+		case "prev":
+			player.Prev()
+		default:
+			return ctlResult("", fmt.Errorf("unknown player action '%s'", req.Args))
+		}
+		return ctlResult("", nil)
+	case "playlist":
+		if req.Args == "" {
+			return ctlResult("", errors.New("missing playlist"))
+		}
+		player.PlayPlaylist(req.Args)
+		return ctlResult("", nil)
+	case "backlight":
+		switch req.Args {
+		case "on":
+			d.wake(true)
+			d.disp.SetBacklight(true)
+		case "off":
+			d.idleOff = false
+			d.disp.SetBacklight(false)
+			d.screens = nil
+			d.display(false)
+		case "toggle":
+			d.NewCommand(configuration.Keys.ToggleLCD)
+		default:
+			return ctlResult("", fmt.Errorf("unknown backlight action '%s'", req.Args))
+		}
+		return ctlResult("", nil)
+	case "mpd":
+		fields, err := splitArgs(req.Args)
+		if err != nil {
+			return ctlResult("", err)
+		}
+		if len(fields) == 0 {
+			return ctlResult("", errors.New("missing mpd command"))
+		}
+		if _, ok := player.(*MPD); !ok {
+			return ctlResult("", errors.New("player is not mpd"))
+		}
+		return ctlResult("", MPDCommand(fields[0], fields[1:]...))
+	case "macro":
+		return ctlResult("", macros.Run(req.Args))
+	case "loglevel":
+		return ctlResult(setLogLevelCmd(req.Args))
+	case "screen":
+		return ctlResult(d.lastContent, nil)
+	case "menu":
+		return ctlResult("", d.openMenu(req.Args))
+	}
+	return ctlResult("", fmt.Errorf("unknown command '%s'", req.Cmd))
+}
+
+// splitArgs split `args` by spaces; arguments containing spaces can be
+// enclosed in double quotes, ie. `load "My Playlist"`; backslash escape
+// quote and backslash in quoted argument
+func splitArgs(args string) (res []string, err error) {
+	var arg strings.Builder
+	inArg, quoted := false, false
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(args):
+			i++
+			arg.WriteByte(args[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArg {
+				res = append(res, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		res = append(res, arg.String())
+	}
+	return res, nil
+}
+
+// setLogLevelCmd handle "loglevel [subsystem] [level]"; level "default"
+// remove subsystem level. Return current levels.
+func setLogLevelCmd(args string) (string, error) {
+	fields := strings.Fields(args)
+	switch len(fields) {
+	case 0:
+	case 1:
+		level, err := parseLogLevel(fields[0])
+		if err != nil {
+			return "", err
+		}
+		logger.SetLogLevel(level)
+	case 2:
+		known := false
+		for _, sub := range logSubsystems {
+			known = known || sub == fields[0]
+		}
+		if !known {
+			return "", fmt.Errorf("unknown subsystem '%s'", fields[0])
+		}
+		level := -1
+		if fields[1] != "default" {
+			var err error
+			if level, err = parseLogLevel(fields[1]); err != nil {
+				return "", err
+			}
+		}
+		logger.SetSubsystemLevel(fields[0], level)
+	default:
+		return "", errors.New("usage: loglevel [subsystem] [level]")
+	}
+	return logger.LogLevels(), nil
+}
+
+// openMenu open or execute menu item defined by `path` of labels
+// (ie. "/power/reboot")
+func (d *ScreenMgr) openMenu(path string) error {
+	menu := configuration.Menu
+	screens := []Screen{menu}
+	parts := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	for i, name := range parts {
+		idx := -1
+		for j, item := range menu.Items {
+			if strings.EqualFold(item.Label, name) {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("menu item '%s' not found", name)
+		}
+		menu.SetCursor(idx)
+		item := menu.Items[idx]
+		if len(item.Items) == 0 {
+			if i < len(parts)-1 {
+				return fmt.Errorf("'%s' is not submenu", name)
+			}
+			res, next := menu.selectItem(idx)
+			if res == ActionResultNop {
+				return fmt.Errorf("can't execute '%s'", name)
+			}
+			d.wake(false)
+			d.screens = screens
+			d.handleResult(res, next, "")
+			return nil
+		}
+		item.refreshToggles()
+		menu = item
+		screens = append(screens, menu)
+	}
+	d.wake(false)
+	d.screens = screens
+	d.display(false)
+	return nil
+}
+
+// ctlMain send commands given in `args` or read from stdin to control socket
+// of running rpilcd; return exit code
+func ctlMain(args []string) int {
+	if err := loadConfiguration(); err != nil {
+		fmt.Fprintln(os.Stderr, "load configuration error:", err)
+		return 2
+	}
+	path := configuration.ServicesConf.ControlSocket
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "control_socket is not configured")
+		return 2
+	}
+
+	conn, err := net.DialTimeout("unix", path, ctlTimeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect error:", err)
+		return 2
+	}
+	defer conn.Close()
+
+	var cmds []string
+	if len(args) > 0 {
+		cmds = append(cmds, strings.Join(args, " "))
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			cmds = append(cmds, scanner.Text())
+		}
+	}
+
+	res := 0
+	reader := bufio.NewReader(conn)
+	for _, cmd := range cmds {
+		if strings.TrimSpace(cmd) == "" {
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(2 * ctlTimeout))
+		if _, err := fmt.Fprintln(conn, cmd); err != nil {
+			fmt.Fprintln(os.Stderr, "send error:", err)
+			return 2
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "read error:", err)
+			return 2
+		}
+		line = strings.TrimSpace(line)
+		fmt.Println(line)
+		if strings.HasPrefix(line, "ERR") {
+			res = 1
+		}
+	}
+	return res
+}
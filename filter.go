@@ -0,0 +1,222 @@
+package main
+
+// Searching in list-based screens
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// t9Timeout is time after which next press of the same key start new character
+const t9Timeout = 1500 * time.Millisecond
+
+var t9Chars = []string{" 0", ".-_1", "abc2", "def3", "ghi4", "jkl5", "mno6", "pqrs7", "tuv8", "wxyz9"}
+
+// Searchable is implemented by list-based screens that allow jump by letter
+// and filtering
+type Searchable interface {
+	// ItemLabels return labels of all items in list
+	ItemLabels() []string
+	Cursor() int
+	SetCursor(idx int)
+}
+
+// t9Input handle multi-tap entry of text by numeric keys
+type t9Input struct {
+	text []rune
+	// pos is cursor position; characters are inserted before cursor
+	pos      int
+	lastKey  int
+	lastTime time.Time
+	tap      int
+}
+
+// key process digit; return true when new character was added
+func (t *t9Input) key(digit int) bool {
+	now := time.Now()
+	chars := []rune(t9Chars[digit])
+	if digit == t.lastKey && now.Sub(t.lastTime) < t9Timeout && t.pos > 0 {
+		t.tap = (t.tap + 1) % len(chars)
+		t.text[t.pos-1] = chars[t.tap]
+		t.lastTime = now
+		return false
+	}
+	t.lastKey = digit
+	t.lastTime = now
+	t.tap = 0
+	t.text = append(t.text[:t.pos], append([]rune{chars[0]}, t.text[t.pos:]...)...)
+	t.pos++
+	return true
+}
+
+// backspace remove character before cursor; return false when there is
+// nothing to remove
+func (t *t9Input) backspace() bool {
+	t.lastKey = -1
+	if t.pos == 0 {
+		return false
+	}
+	t.text = append(t.text[:t.pos-1], t.text[t.pos:]...)
+	t.pos--
+	return true
+}
+
+// move cursor by `step` characters; cursor may be placed after last character
+func (t *t9Input) move(step int) {
+	t.lastKey = -1
+	t.pos += step
+	if t.pos < 0 {
+		t.pos = 0
+	} else if t.pos > len(t.text) {
+		t.pos = len(t.text)
+	}
+}
+
+// change replace character under cursor by next/previous from `chars`;
+// on the end of text new character is added
+func (t *t9Input) change(chars string, step int) {
+	t.lastKey = -1
+	runes := []rune(chars)
+	if t.pos == len(t.text) {
+		t.text = append(t.text, runes[0])
+	}
+	idx := 0
+	for i, r := range runes {
+		if r == t.text[t.pos] {
+			idx = i
+			break
+		}
+	}
+	idx = (idx + step + len(runes)) % len(runes)
+	t.text[t.pos] = runes[idx]
+}
+
+func (t *t9Input) String() string {
+	return string(t.text)
+}
+
+// firstLetter return upper-cased first letter or digit of `label`
+func firstLetter(label string) rune {
+	for _, r := range label {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+	}
+	return 0
+}
+
+// nextLetterIndex find first item starting with alphabetically next letter
+// (present in list) after letter of current item; wrap to lowest letter
+func nextLetterIndex(labels []string, cursor int) int {
+	if len(labels) == 0 {
+		return 0
+	}
+	if cursor < 0 || cursor >= len(labels) {
+		cursor = 0
+	}
+	curr := firstLetter(labels[cursor])
+	var next, lowest rune
+	for _, label := range labels {
+		l := firstLetter(label)
+		if l == 0 {
+			continue
+		}
+		if lowest == 0 || l < lowest {
+			lowest = l
+		}
+		if l > curr && (next == 0 || l < next) {
+			next = l
+		}
+	}
+	if next == 0 {
+		next = lowest
+	}
+	for i, label := range labels {
+		if firstLetter(label) == next {
+			return i
+		}
+	}
+	return cursor
+}
+
+// FilterScreen narrow list of parent screen to items starting with entered
+// prefix; selected item is set as current in parent
+type FilterScreen struct {
+	parent  Searchable
+	labels  []string
+	input   t9Input
+	matches []int
+	cursor  int
+}
+
+// NewFilterScreen create filter for `parent` list
+func NewFilterScreen(parent Searchable) *FilterScreen {
+	f := &FilterScreen{
+		parent: parent,
+		labels: parent.ItemLabels(),
+		input:  t9Input{lastKey: -1},
+	}
+	f.filter()
+	return f
+}
+
+func (f *FilterScreen) filter() {
+	prefix := strings.ToLower(f.input.String())
+	f.matches = f.matches[:0]
+	for i, l := range f.labels {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(l)), prefix) {
+			f.matches = append(f.matches, i)
+		}
+	}
+	f.cursor = 0
+}
+
+func (f *FilterScreen) Show() (res []string, fixPart int) {
+	res = append(res, "/"+f.input.String()+"_ ("+strconv.Itoa(len(f.matches))+")")
+	if len(f.matches) == 0 {
+		res = append(res, "no match")
+	} else {
+		res = append(res, CharCursor+f.labels[f.matches[f.cursor]])
+		fixPart = 1
+	}
+	return
+}
+
+func (f *FilterScreen) Action(action string) (result int, screen Screen) {
+	if digit := digitKey(action); digit >= 0 {
+		f.input.key(digit)
+		f.filter()
+		return ActionResultOk, nil
+	}
+
+	switch action {
+	case configuration.Keys.Menu.Up:
+		if len(f.matches) > 0 {
+			f.cursor = (f.cursor + len(f.matches) - 1) % len(f.matches)
+		}
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Down:
+		if len(f.matches) > 0 {
+			f.cursor = (f.cursor + 1) % len(f.matches)
+		}
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Select:
+		if len(f.matches) > 0 {
+			f.parent.SetCursor(f.matches[f.cursor])
+		}
+		return ActionResultBack, nil
+	case configuration.Keys.Menu.Back:
+		if f.input.backspace() {
+			f.filter()
+			return ActionResultOk, nil
+		}
+		return ActionResultBack, nil
+	}
+	return ActionResultOk, nil
+}
+
+func (f *FilterScreen) Valid() bool {
+	return true
+}
@@ -0,0 +1,301 @@
+package main
+
+// Played songs history and local scrobbling
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scrobble when song was played at least half or this time
+	scrobbleMinPlayTime = 4 * time.Minute
+	// do not scrobble songs shorter than
+	scrobbleMinDuration = 30 * time.Second
+	historyScreenItems  = 50
+)
+
+// HistoryEntry is one played song
+type HistoryEntry struct {
+	ListenedAt int64  `json:"listened_at"`
+	Artist     string `json:"artist,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Album      string `json:"album,omitempty"`
+	Track      string `json:"track,omitempty"`
+	File       string `json:"file"`
+	// Duration of song in seconds
+	Duration int `json:"duration,omitempty"`
+}
+
+// History track currently played song and log played songs
+type History struct {
+	mu sync.Mutex
+
+	// currently tracked song
+	songID  string
+	song    HistoryEntry
+	started time.Time
+	// time of playing song accumulated before last pause
+	played    time.Duration
+	playingAt time.Time
+}
+
+var history = &History{}
+
+// Update check current mpd state; should be called on each "player" event
+func (h *History) Update() {
+	if configuration.HistoryConf.File == "" {
+		return
+	}
+
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+
+	status, err := con.Status()
+	if err != nil {
+		logger.Errorf("History.Update: Status error: %v", err)
+		return
+	}
+	song, err := con.CurrentSong()
+	if err != nil {
+		logger.Errorf("History.Update: CurrentSong error: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	state := status["state"]
+	songID := status["songid"]
+	if state == "stop" {
+		songID = ""
+	}
+
+	if songID != h.songID {
+		h.finish(now)
+		h.songID = songID
+		h.played = 0
+		h.playingAt = time.Time{}
+		if songID != "" {
+			h.started = now
+			h.song = HistoryEntry{
+				Artist: song["Artist"],
+				Title:  song["Title"],
+				Album:  song["Album"],
+				Track:  song["Track"],
+				File:   song["file"],
+			}
+			h.song.Duration, _ = strconv.Atoi(song["Time"])
+		}
+	}
+
+	if h.songID == "" {
+		return
+	}
+	if state == "play" {
+		if h.playingAt.IsZero() {
+			h.playingAt = now
+		}
+	} else if !h.playingAt.IsZero() {
+		h.played += now.Sub(h.playingAt)
+		h.playingAt = time.Time{}
+	}
+}
+
+// finish tracking current song and log it when scrobble rules are met
+func (h *History) finish(now time.Time) {
+	if h.songID == "" {
+		return
+	}
+	played := h.played
+	if !h.playingAt.IsZero() {
+		played += now.Sub(h.playingAt)
+	}
+	duration := time.Duration(h.song.Duration) * time.Second
+	if duration > 0 && duration < scrobbleMinDuration {
+		return
+	}
+	if played < duration/2 && played < scrobbleMinPlayTime {
+		logger.Debugf("History: skip %s - played %v", h.song.File, played)
+		return
+	}
+	// streams don't have duration; log after scrobbleMinPlayTime
+	if duration == 0 && played < scrobbleMinPlayTime {
+		return
+	}
+	h.song.ListenedAt = h.started.Unix()
+	h.append(&h.song)
+}
+
+func (h *History) append(entry *HistoryEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Errorf("History.append marshal error: %v", err)
+		return
+	}
+	f, err := os.OpenFile(configuration.HistoryConf.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf("History.append open error: %v", err)
+		return
+	}
+	defer f.Close()
+
+	data = append(data, '\n')
+	if _, err = f.Write(data); err != nil {
+		logger.Errorf("History.append write error: %v", err)
+	}
+	logger.Infof("History: played %s - %s", entry.Artist, entry.Title)
+}
+
+// Entries return all logged entries listened after `since` (unix time)
+func (h *History) Entries(since int64) (entries []*HistoryEntry) {
+	if configuration.HistoryConf.File == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(configuration.HistoryConf.File)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("History.Entries open error: %v", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			logger.Errorf("History.Entries unmarshal error: %v", err)
+			continue
+		}
+		if entry.ListenedAt > since {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Errorf("History.Entries read error: %v", err)
+	}
+	return
+}
+
+// Label return entry description
+func (e *HistoryEntry) Label() string {
+	if e.Artist != "" && e.Title != "" {
+		return e.Artist + " - " + e.Title
+	}
+	if e.Title != "" {
+		return e.Title
+	}
+	return e.File
+}
+
+// NewHistoryScreen create screen with recently played songs
+func NewHistoryScreen() *ListScreen {
+	entries := history.Entries(0)
+	var lines []string
+	for i := len(entries) - 1; i >= 0 && len(lines) < historyScreenItems; i-- {
+		e := entries[i]
+		ts := time.Unix(e.ListenedAt, 0).Format("15:04")
+		lines = append(lines, ts+" "+e.Label())
+	}
+	return &ListScreen{
+		Source:      StringsSource(lines),
+		Empty:       "No history",
+		CursorGlyph: " ",
+		NoWrap:      true,
+	}
+}
+
+// WebHandler export history; params: format=listenbrainz|audioscrobbler|jsonl,
+// since=unix time
+func (h *History) WebHandler(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.ParseInt(r.FormValue("since"), 10, 64)
+	entries := h.Entries(since)
+
+	switch r.FormValue("format") {
+	case "audioscrobbler":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeAudioScrobblerLog(w, entries)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			enc.Encode(e)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		writeListenBrainz(w, entries)
+	}
+}
+
+type lbTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info,omitempty"`
+}
+
+type lbListen struct {
+	ListenedAt    int64           `json:"listened_at"`
+	TrackMetadata lbTrackMetadata `json:"track_metadata"`
+}
+
+// writeListenBrainz write entries as ListenBrainz "import" submission
+func writeListenBrainz(w http.ResponseWriter, entries []*HistoryEntry) {
+	listens := make([]lbListen, 0, len(entries))
+	for _, e := range entries {
+		l := lbListen{
+			ListenedAt: e.ListenedAt,
+			TrackMetadata: lbTrackMetadata{
+				ArtistName:  e.Artist,
+				TrackName:   e.Title,
+				ReleaseName: e.Album,
+				AdditionalInfo: map[string]interface{}{
+					"media_player": "rpilcd",
+				},
+			},
+		}
+		if l.TrackMetadata.TrackName == "" {
+			l.TrackMetadata.TrackName = e.File
+		}
+		if e.Duration > 0 {
+			l.TrackMetadata.AdditionalInfo["duration_ms"] = e.Duration * 1000
+		}
+		if e.Track != "" {
+			l.TrackMetadata.AdditionalInfo["tracknumber"] = e.Track
+		}
+		listens = append(listens, l)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"listen_type": "import",
+		"payload":     listens,
+	})
+}
+
+// writeAudioScrobblerLog write entries in .scrobbler.log format
+func writeAudioScrobblerLog(w http.ResponseWriter, entries []*HistoryEntry) {
+	clean := func(s string) string {
+		return strings.Replace(s, "\t", " ", -1)
+	}
+	fmt.Fprint(w, "#AUDIOSCROBBLER/1.1\n#TZ/UTC\n#CLIENT/rpilcd "+AppVersion+"\n")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\tL\t%d\t\n",
+			clean(e.Artist), clean(e.Album), clean(e.Title), clean(e.Track),
+			e.Duration, e.ListenedAt)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+// On-screen text input
+
+// inputChars are characters selected by Up/Down keys in text input
+const inputChars = " abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.,-_@:/!?#+*="
+
+// CursorScreen is implemented by screens that show cursor on display
+type CursorScreen interface {
+	// CursorPos return cursor position; negative col hide cursor
+	CursorPos() (col, row int)
+}
+
+// TextInputScreen allow enter text by remote. Up/Down change character under
+// cursor, Left/Right move cursor, numeric keys enter text like on phone
+// (multi-tap), Back delete character and Select confirm text.
+type TextInputScreen struct {
+	Prompt string
+	// Done is called with entered text; returned screen replace input
+	Done func(value string) (result int, screen Screen)
+
+	input  t9Input
+	offset int
+}
+
+// NewTextInputScreen create input with initial `value`
+func NewTextInputScreen(prompt, value string, done func(value string) (int, Screen)) *TextInputScreen {
+	t := &TextInputScreen{
+		Prompt: prompt,
+		Done:   done,
+		input:  t9Input{lastKey: -1, text: []rune(value)},
+	}
+	t.input.pos = len(t.input.text)
+	return t
+}
+
+// Value return entered text
+func (t *TextInputScreen) Value() string {
+	return t.input.String()
+}
+
+// scroll text horizontally to keep cursor visible
+func (t *TextInputScreen) scroll() {
+	if t.input.pos < t.offset {
+		t.offset = t.input.pos
+	} else if t.input.pos >= t.offset+lcdWidth {
+		t.offset = t.input.pos - lcdWidth + 1
+	}
+}
+
+func (t *TextInputScreen) Show() (res []string, fixPart int) {
+	t.scroll()
+	text := t.input.text[t.offset:]
+	if len(text) > lcdWidth {
+		text = text[:lcdWidth]
+	}
+	return []string{t.Prompt, string(text)}, 0
+}
+
+func (t *TextInputScreen) CursorPos() (col, row int) {
+	t.scroll()
+	return t.input.pos - t.offset, 1
+}
+
+func (t *TextInputScreen) Action(action string) (result int, screen Screen) {
+	if digit := digitKey(action); digit >= 0 {
+		t.input.key(digit)
+		return ActionResultOk, nil
+	}
+
+	switch action {
+	case configuration.Keys.Menu.Up:
+		t.input.change(inputChars, 1)
+	case configuration.Keys.Menu.Down:
+		t.input.change(inputChars, -1)
+	case configuration.Keys.Menu.Left:
+		t.input.move(-1)
+	case configuration.Keys.Menu.Right:
+		t.input.move(1)
+	case configuration.Keys.Menu.Select:
+		if t.Done == nil {
+			return ActionResultBack, nil
+		}
+		res, next := t.Done(t.Value())
+		if res == ActionResultOk {
+			return ActionResultReplace, next
+		}
+		return res, next
+	case configuration.Keys.Menu.Back:
+		if !t.input.backspace() && len(t.input.text) == 0 {
+			// cancel
+			return ActionResultBack, nil
+		}
+	}
+	return ActionResultOk, nil
+}
+
+func (t *TextInputScreen) Valid() bool {
+	return true
+}
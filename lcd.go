@@ -33,6 +33,10 @@ type Lcd struct {
 	lastLines [][]byte
 	active    bool
 	backlight bool
+
+	// cursor position; cursorCol < 0 when cursor is hidden
+	cursorCol int
+	cursorRow int
 }
 
 // NewLcd create and init new lcd output
@@ -40,7 +44,7 @@ func NewLcd() *Lcd {
 	var l *Lcd
 	defer func() {
 		if e := recover(); e != nil {
-			logger.Infof("NewLcd failed create - recover: %v", e)
+			lcdLog.Infof("NewLcd failed create - recover: %v", e)
 		}
 	}()
 
@@ -48,13 +52,14 @@ func NewLcd() *Lcd {
 		Lines:     2,
 		Width:     lcdWidth,
 		lastLines: make([][]byte, 2, 2),
+		cursorCol: -1,
 	}
 	if configuration.DisplayConf.Display == "i2c" {
 		l.addr = configuration.DisplayConf.I2CAddr
-		logger.Debugf("Starting hd44780 on i2c addr=%d", l.addr)
+		lcdLog.Debugf("Starting hd44780 on i2c addr=%d", l.addr)
 
 		if err := embd.InitI2C(); err != nil {
-			logger.Error("Can't open lcd: ", err.Error())
+			lcdLog.Error("Can't open lcd: ", err.Error())
 			return nil
 		}
 
@@ -67,16 +72,16 @@ func NewLcd() *Lcd {
 			hd44780.PCF8574PinMap,
 			hd44780.RowAddress16Col,
 			hd44780.TwoLine,
-			//		hd44780.BlinkOff,
+			hd44780.BlinkOff,
 			hd44780.CursorOff,
 			hd44780.EntryIncrement,
 		)
 		if err != nil {
-			logger.Fatal("Can't open i2c lcd: ", err.Error())
+			lcdLog.Fatal("Can't open i2c lcd: ", err.Error())
 			return nil
 		}
 	} else {
-		logger.Debugf("Starting hd44780 on GPIO")
+		lcdLog.Debugf("Starting hd44780 on GPIO")
 		var err error
 		l.hd, err = hd44780.NewGPIO(
 			configuration.DisplayConf.GpioRs,
@@ -89,12 +94,12 @@ func NewLcd() *Lcd {
 			hd44780.Positive,
 			hd44780.RowAddress16Col,
 			hd44780.TwoLine,
-			//		hd44780.BlinkOff,
+			hd44780.BlinkOff,
 			hd44780.CursorOff,
 			hd44780.EntryIncrement,
 		)
 		if err != nil {
-			logger.Fatal("Can't open gpio lcd: ", err.Error())
+			lcdLog.Fatal("Can't open gpio lcd: ", err.Error())
 			return nil
 		}
 	}
@@ -122,6 +127,10 @@ func (l *Lcd) Display(msg string) {
 	for line, text := range bytes.Split(msgb, []byte("\n")) {
 		l.DisplayLine(line, text)
 	}
+	// writing move cursor; restore it
+	if l.cursorCol >= 0 && l.Active() {
+		l.hd.SetCursor(l.cursorCol, l.cursorRow)
+	}
 }
 
 // DisplayLine display `text` in `line`.
@@ -132,8 +141,10 @@ func (l *Lcd) DisplayLine(line int, text []byte) {
 
 	// skip not changed lines
 	if bytes.Compare(l.lastLines[line], text) == 0 {
+		metricsDisplaySkips.Inc()
 		return
 	}
+	metricsDisplayWrites.Inc()
 
 	l.lastLines[line] = text
 
@@ -150,9 +161,30 @@ func (l *Lcd) DisplayLine(line int, text []byte) {
 	}
 }
 
+// SetCursor show blinking cursor in given position or hide it when `col` < 0
+func (l *Lcd) SetCursor(col, row int) {
+	if !l.active || (col == l.cursorCol && row == l.cursorRow) {
+		return
+	}
+	if col < 0 {
+		l.hd.CursorOff()
+		l.hd.BlinkOff()
+	} else {
+		if l.cursorCol < 0 {
+			l.hd.CursorOn()
+			l.hd.BlinkOn()
+		}
+		if col >= l.Width {
+			col = l.Width - 1
+		}
+		l.hd.SetCursor(col, row)
+	}
+	l.cursorCol, l.cursorRow = col, row
+}
+
 // Close LCD
 func (l *Lcd) Close() {
-	logger.Infof("Lcd.Close")
+	lcdLog.Infof("Lcd.Close")
 }
 
 // ToggleBacklight turn off/on lcd backlight
@@ -175,6 +207,13 @@ func (l *Lcd) ToggleBacklight() {
 	}
 }
 
+// SetBacklight turn on or off lcd backlight
+func (l *Lcd) SetBacklight(on bool) {
+	if l.backlight != on {
+		l.ToggleBacklight()
+	}
+}
+
 func (l *Lcd) setChar(pos byte, def []byte) {
 	if len(def) != 8 {
 		panic("invalid def - req 8 bytes")
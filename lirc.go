@@ -14,7 +14,7 @@ func NewLirc() *Lirc {
 		Events: make(chan string, 5),
 	}
 	if configuration.LircConf.PidFile == "" {
-		logger.Error("Lirc not configured")
+		lircLog.Error("Lirc not configured")
 		return l
 	}
 
@@ -37,14 +37,14 @@ func NewLirc() *Lirc {
 }
 
 func (l *Lirc) handler(event lirc.Event) {
-	logger.Debugf("lirc ir event: %#v", event)
+	lircLog.Debugf("lirc ir event: %#v", event)
 	l.Events <- event.Button
 }
 
 func (l *Lirc) Close() {
 	defer func() {
 		if e := recover(); e != nil {
-			logger.Infof("Recover: %v", e)
+			lircLog.Infof("Recover: %v", e)
 		}
 	}()
 	if l.ir != nil {
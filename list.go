@@ -0,0 +1,300 @@
+package main
+
+// Generic list screen
+
+import (
+	"strconv"
+)
+
+const defaultPageSize = 50
+
+// ListSource provide items for ListScreen
+type ListSource interface {
+	// Len return number of items
+	Len() int
+	// Labels return labels of items in range [start, end)
+	Labels(start, end int) []string
+}
+
+// StringsSource is ListSource for static list of labels
+type StringsSource []string
+
+func (s StringsSource) Len() int {
+	return len(s)
+}
+
+func (s StringsSource) Labels(start, end int) []string {
+	return s[start:end]
+}
+
+// PagedSource load items lazily by pages; useful for large lists
+type PagedSource struct {
+	// PageSize is number of items loaded at once
+	PageSize int
+	// Total return number of items
+	Total func() int
+	// Fetch load labels in range [start, end)
+	Fetch func(start, end int) []string
+
+	total int
+	pages map[int][]string
+}
+
+func (p *PagedSource) Len() int {
+	if p.pages == nil {
+		p.pages = make(map[int][]string)
+		p.total = p.Total()
+	}
+	return p.total
+}
+
+// Labels return labels in range [start, end); missing pages are loaded by one
+// Fetch call
+func (p *PagedSource) Labels(start, end int) (res []string) {
+	size := p.PageSize
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	total := p.Len()
+	if end > total {
+		end = total
+	}
+	if start >= end {
+		return nil
+	}
+
+	first, last := -1, -1
+	for n := start / size; n <= (end-1)/size; n++ {
+		if _, ok := p.pages[n]; !ok {
+			if first < 0 {
+				first = n
+			}
+			last = n
+		}
+	}
+	if first >= 0 {
+		fetchEnd := (last + 1) * size
+		if fetchEnd > total {
+			fetchEnd = total
+		}
+		items := p.Fetch(first*size, fetchEnd)
+		for n := first; n <= last; n++ {
+			lo, hi := (n-first)*size, (n-first+1)*size
+			if lo > len(items) {
+				lo = len(items)
+			}
+			if hi > len(items) {
+				hi = len(items)
+			}
+			p.pages[n] = items[lo:hi]
+		}
+	}
+
+	for i := start; i < end; i++ {
+		page := p.pages[i/size]
+		if idx := i % size; idx < len(page) {
+			res = append(res, page[idx])
+		} else {
+			res = append(res, "")
+		}
+	}
+	return
+}
+
+// Invalidate drop loaded pages
+func (p *PagedSource) Invalidate() {
+	p.pages = nil
+}
+
+// ListScreen display list of items with cursor
+type ListScreen struct {
+	Source ListSource
+	// OnSelect is called when item is selected
+	OnSelect func(idx int) (result int, screen Screen)
+	// Actions are additional per-item actions bound to keys
+	Actions map[string]func(idx int) (result int, screen Screen)
+	// CursorGlyph mark current item; default CharCursor
+	CursorGlyph string
+	// ShowIndex show item numbers
+	ShowIndex bool
+	// NoWrap disable wrapping cursor on begin/end of list
+	NoWrap bool
+	// Empty is text displayed when list is empty
+	Empty string
+	// Reload is called on mpd event ReloadOn
+	Reload   func()
+	ReloadOn string
+
+	cursor int
+	offset int
+}
+
+func (l *ListScreen) glyph() string {
+	if l.CursorGlyph != "" {
+		return l.CursorGlyph
+	}
+	return CharCursor
+}
+
+func (l *ListScreen) Show() (res []string, fixPart int) {
+	items := l.Source.Len()
+	if items == 0 {
+		res = append(res, l.Empty)
+	} else {
+		end := l.offset + lcdHeight
+		if end > items {
+			end = items
+		}
+		glyph := l.glyph()
+		blank := ""
+		for i := 0; i < len(glyph); i++ {
+			blank += " "
+		}
+		for i, label := range l.Source.Labels(l.offset, end) {
+			idx := l.offset + i
+			prefix := ""
+			if l.ShowIndex {
+				prefix = strconv.Itoa(idx+1) + ". "
+			}
+			if len(prefix) > fixPart {
+				fixPart = len(prefix)
+			}
+			if idx == l.cursor {
+				res = append(res, glyph+prefix+label)
+			} else {
+				res = append(res, blank+prefix+label)
+			}
+		}
+		fixPart += len(glyph)
+	}
+	for len(res) < lcdHeight {
+		res = append(res, "")
+	}
+	return
+}
+
+func (l *ListScreen) Action(action string) (result int, screen Screen) {
+	items := l.Source.Len()
+	if f, ok := l.Actions[action]; ok && action != "" {
+		if items == 0 {
+			return ActionResultOk, nil
+		}
+		return f(l.cursor)
+	}
+
+	switch action {
+	case configuration.Keys.Menu.Up:
+		l.move(-1)
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Up10:
+		l.move(-10)
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Down:
+		l.move(1)
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Down10:
+		l.move(10)
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Select:
+		if items == 0 || l.OnSelect == nil {
+			return ActionResultOk, nil
+		}
+		return l.OnSelect(l.cursor)
+	case configuration.Keys.Menu.Back:
+		return ActionResultBack, nil
+	}
+	return
+}
+
+func (l *ListScreen) move(step int) {
+	items := l.Source.Len()
+	if items == 0 {
+		return
+	}
+	if !l.NoWrap {
+		if step < 0 {
+			l.cursor, l.offset = cursorScrollUp(l.cursor, l.offset, items, -step)
+		} else {
+			l.cursor, l.offset = cursorScrollDown(l.cursor, l.offset, items, step)
+		}
+		return
+	}
+	cursor := l.cursor + step
+	if cursor < 0 {
+		cursor = 0
+	} else if cursor >= items {
+		cursor = items - 1
+	}
+	l.cursor = cursor
+	if l.offset > cursor {
+		l.offset = cursor
+	} else if l.offset < cursor-lcdHeight+1 {
+		l.offset = cursor - lcdHeight + 1
+	}
+}
+
+func (l *ListScreen) Valid() bool {
+	return true
+}
+
+// SelectNumber move cursor to item `num`
+func (l *ListScreen) SelectNumber(num int, confirmed bool) (result int, screen Screen) {
+	l.SetCursor(num - 1)
+	return ActionResultOk, nil
+}
+
+func (l *ListScreen) ItemLabels() []string {
+	return l.Source.Labels(0, l.Source.Len())
+}
+
+func (l *ListScreen) Cursor() int {
+	return l.cursor
+}
+
+func (l *ListScreen) SetCursor(idx int) {
+	l.cursor, l.offset = cursorJump(l.cursor, l.offset, l.Source.Len(), idx)
+}
+
+// MPDEvent reload list on configured mpd subsystem change
+func (l *ListScreen) MPDEvent(subsystem string) {
+	if l.Reload == nil || subsystem != l.ReloadOn {
+		return
+	}
+	l.Reload()
+	l.cursor, l.offset = fixCursor(l.cursor, l.offset, l.Source.Len())
+}
+
+// NewChoiceScreen create list of `values` with current value marked by "*";
+// selecting item call `apply` and move mark. `label` format value for display.
+func NewChoiceScreen(values []string, curr string, label func(string) string,
+	apply func(string)) *ListScreen {
+	l := &ListScreen{Empty: "No items"}
+	update := func() {
+		var labels []string
+		for _, v := range values {
+			lbl := v
+			if label != nil {
+				lbl = label(v)
+			}
+			if v == curr {
+				labels = append(labels, "*"+lbl)
+			} else {
+				labels = append(labels, " "+lbl)
+			}
+		}
+		l.Source = StringsSource(labels)
+	}
+	l.OnSelect = func(idx int) (int, Screen) {
+		apply(values[idx])
+		curr = values[idx]
+		update()
+		return ActionResultOk, nil
+	}
+	update()
+	for i, v := range values {
+		if v == curr {
+			l.SetCursor(i)
+		}
+	}
+	return l
+}
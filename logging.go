@@ -5,74 +5,306 @@
 package main
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+)
+
+// log levels
+const (
+	LogSilent = iota
+	LogError
+	LogInfo
+	LogDebug
 )
 
+var logLevelNames = []string{"silent", "error", "info", "debug"}
+
+// logSubsystems are names of subsystems with own log level
+var logSubsystems = []string{"mpd", "mpv", "lcd", "lirc", "screen"}
+
+// parseLogLevel parse level name or number
+func parseLogLevel(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for i, name := range logLevelNames {
+		if name == value {
+			return i, nil
+		}
+	}
+	if level, err := strconv.Atoi(value); err == nil && level >= LogSilent && level <= LogDebug {
+		return level, nil
+	}
+	return 0, fmt.Errorf("invalid log level '%s'", value)
+}
+
+func logLevelName(level int) string {
+	if level < LogSilent || level > LogDebug {
+		return strconv.Itoa(level)
+	}
+	return logLevelNames[level]
+}
+
+// logSettings are shared by all loggers
+type logSettings struct {
+	sync.RWMutex
+	level int
+	// levels of subsystems
+	levels map[string]int
+	// format is "text", "kv" or "json"
+	format  string
+	journal bool
+	out     io.Writer
+}
+
+var logConf = &logSettings{
+	level:  LogError,
+	levels: make(map[string]int),
+	format: "text",
+	out:    os.Stdout,
+}
+
+// Logger write messages with level, subsystem and fields
 type Logger struct {
-	*log.Logger
-	logLevel int
+	subsystem string
+	// fields are key, value pairs
+	fields []string
 }
 
+var logger = Logger{}
+
+var (
+	mpdLog    = logger.Sub("mpd")
+	mpvLog    = logger.Sub("mpv")
+	lcdLog    = logger.Sub("lcd")
+	lircLog   = logger.Sub("lirc")
+	screenLog = logger.Sub("screen")
+)
+
+// Sub create logger for `subsystem`
+func (l *Logger) Sub(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem, fields: l.fields}
+}
+
+// With create logger with additional fields given as key, value pairs
+func (l *Logger) With(kv ...string) *Logger {
+	fields := make([]string, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{subsystem: l.subsystem, fields: fields}
+}
+
+// SetLogLevel set global log level
 func (l *Logger) SetLogLevel(level int) {
-	l.logLevel = level
+	logConf.Lock()
+	defer logConf.Unlock()
+	logConf.level = level
+}
+
+// SetSubsystemLevel set log level for `subsystem`; negative level remove
+// subsystem level
+func (l *Logger) SetSubsystemLevel(subsystem string, level int) {
+	logConf.Lock()
+	defer logConf.Unlock()
+	if level < 0 {
+		delete(logConf.levels, subsystem)
+	} else {
+		logConf.levels[subsystem] = level
+	}
+}
+
+// LogLevels return description of current log levels
+func (l *Logger) LogLevels() string {
+	logConf.RLock()
+	defer logConf.RUnlock()
+	res := []string{"level=" + logLevelName(logConf.level)}
+	var subs []string
+	for sub := range logConf.levels {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+	for _, sub := range subs {
+		res = append(res, sub+"="+logLevelName(logConf.levels[sub]))
+	}
+	return strings.Join(res, " ")
+}
+
+// configureLogging apply configuration from [logging] section
+func configureLogging(conf *LoggingConf) {
+	logConf.Lock()
+	defer logConf.Unlock()
+	if conf.Level != "" {
+		if level, err := parseLogLevel(conf.Level); err == nil {
+			logConf.level = level
+		}
+	}
+	logConf.levels = make(map[string]int)
+	for sub, value := range conf.Levels {
+		if level, err := parseLogLevel(value); err == nil {
+			logConf.levels[sub] = level
+		}
+	}
+	switch conf.Format {
+	case "kv", "json":
+		logConf.format = conf.Format
+	default:
+		logConf.format = "text"
+	}
+	logConf.journal = conf.Output == "journal" && journal.Enabled()
+}
+
+func (l *Logger) enabled(level int) bool {
+	logConf.RLock()
+	defer logConf.RUnlock()
+	max := logConf.level
+	if sl, ok := logConf.levels[l.subsystem]; ok {
+		max = sl
+	}
+	return level <= max
+}
+
+var journalPriority = map[int]journal.Priority{
+	LogError: journal.PriErr,
+	LogInfo:  journal.PriInfo,
+	LogDebug: journal.PriDebug,
+}
+
+func (l *Logger) output(level int, msg string) {
+	logConf.Lock()
+	defer logConf.Unlock()
+
+	if logConf.journal {
+		vars := make(map[string]string)
+		if l.subsystem != "" {
+			vars["SUBSYSTEM"] = l.subsystem
+		}
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			vars[strings.ToUpper(l.fields[i])] = l.fields[i+1]
+		}
+		if err := journal.Send(msg, journalPriority[level], vars); err == nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	var line string
+	switch logConf.format {
+	case "json":
+		rec := map[string]string{
+			"time":  now.Format(time.RFC3339),
+			"level": logLevelName(level),
+			"msg":   msg,
+		}
+		if l.subsystem != "" {
+			rec["subsystem"] = l.subsystem
+		}
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			rec[l.fields[i]] = l.fields[i+1]
+		}
+		buf, _ := json.Marshal(rec)
+		line = string(buf)
+	case "kv":
+		res := []string{
+			"time=" + now.Format(time.RFC3339),
+			"level=" + logLevelName(level),
+		}
+		if l.subsystem != "" {
+			res = append(res, "subsystem="+l.subsystem)
+		}
+		res = append(res, "msg="+kvValue(msg))
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			res = append(res, l.fields[i]+"="+kvValue(l.fields[i+1]))
+		}
+		line = strings.Join(res, " ")
+	default:
+		line = now.Format("2006/01/02 15:04:05") + " " + strings.ToUpper(logLevelName(level)) + " "
+		if l.subsystem != "" {
+			line += "[" + l.subsystem + "] "
+		}
+		line += msg
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			line += " " + l.fields[i] + "=" + kvValue(l.fields[i+1])
+		}
+	}
+	io.WriteString(logConf.out, line+"\n")
+}
+
+// kvValue quote value when necessary
+func kvValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
 }
 
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	if l.logLevel > 2 {
-		l.Printf(format, v...)
+	if l.enabled(LogDebug) {
+		l.output(LogDebug, fmt.Sprintf(format, v...))
 	}
 }
 
 func (l *Logger) Debugln(v ...interface{}) {
-	if l.logLevel > 2 {
-		l.Println(v...)
+	if l.enabled(LogDebug) {
+		l.output(LogDebug, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
 func (l *Logger) Debug(v ...interface{}) {
-	if l.logLevel > 2 {
-		l.Print(v...)
+	if l.enabled(LogDebug) {
+		l.output(LogDebug, fmt.Sprint(v...))
 	}
 }
 
 func (l *Logger) Infof(format string, v ...interface{}) {
-	if l.logLevel > 1 {
-		l.Printf(format, v...)
+	if l.enabled(LogInfo) {
+		l.output(LogInfo, fmt.Sprintf(format, v...))
 	}
 }
 
 func (l *Logger) Infoln(v ...interface{}) {
-	if l.logLevel > 1 {
-		l.Println(v...)
+	if l.enabled(LogInfo) {
+		l.output(LogInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
 func (l *Logger) Info(v ...interface{}) {
-	if l.logLevel > 1 {
-		l.Print(v...)
+	if l.enabled(LogInfo) {
+		l.output(LogInfo, fmt.Sprint(v...))
 	}
 }
 
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	if l.logLevel > 0 {
-		l.Printf(format, v...)
+	if l.enabled(LogError) {
+		l.output(LogError, fmt.Sprintf(format, v...))
 	}
 }
 
 func (l *Logger) Errorln(v ...interface{}) {
-	if l.logLevel > 0 {
-		l.Println(v...)
+	if l.enabled(LogError) {
+		l.output(LogError, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
 func (l *Logger) Error(v ...interface{}) {
-	if l.logLevel > 0 {
-		l.Print(v...)
+	if l.enabled(LogError) {
+		l.output(LogError, fmt.Sprint(v...))
 	}
 }
 
-var logger = Logger{
-	log.New(os.Stdout, "", log.LstdFlags),
-	1,
+// Printf write message regardless of log level
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(LogInfo, fmt.Sprintf(format, v...))
+}
+
+// Fatal write error and exit
+func (l *Logger) Fatal(v ...interface{}) {
+	l.output(LogError, fmt.Sprint(v...))
+	os.Exit(1)
 }
@@ -0,0 +1,267 @@
+package main
+
+// Watching journal and log files for messages matching rules
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logWatchPollInterval = time.Second
+
+// LogWatchRule define pattern watched in journal unit or log file
+type LogWatchRule struct {
+	// Unit is systemd unit which journal is watched
+	Unit string
+	// File is path to watched log file (when Unit is empty)
+	File string
+	// Pattern is regular expression matched against each line
+	Pattern string
+	// Message show when line match; "{1}", "{name}" are replaced by capture
+	// groups, "{line}" by whole line, "{count}" by number of matches
+	// since last message
+	Message string
+	// RateLimit is minimal interval between messages in seconds
+	RateLimit int
+
+	re      *regexp.Regexp
+	last    time.Time
+	matches int
+}
+
+// source return key identifying watched journal unit or file
+func (r *LogWatchRule) source() string {
+	if r.Unit != "" {
+		return "unit:" + r.Unit
+	}
+	return "file:" + r.File
+}
+
+var logWatchPlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// format message from template and match
+func (r *LogWatchRule) format(line string, match []string) string {
+	msg := r.Message
+	if msg == "" {
+		msg = "{line}"
+	}
+	return logWatchPlaceholder.ReplaceAllStringFunc(msg, func(ph string) string {
+		name := ph[1 : len(ph)-1]
+		switch name {
+		case "line":
+			return line
+		case "count":
+			return strconv.Itoa(r.matches)
+		}
+		if idx, err := strconv.Atoi(name); err == nil {
+			if idx < len(match) {
+				return match[idx]
+			}
+			return ""
+		}
+		if idx := r.re.SubexpIndex(name); idx >= 0 {
+			return match[idx]
+		}
+		return ph
+	})
+}
+
+// check line and return message to display (if any)
+func (r *LogWatchRule) check(line string, now time.Time) string {
+	match := r.re.FindStringSubmatch(line)
+	if match == nil {
+		return ""
+	}
+	r.matches++
+	if !r.last.IsZero() && now.Sub(r.last) < time.Duration(r.RateLimit)*time.Second {
+		logger.Debugf("LogWatch: %s rate limited: %s", r.source(), line)
+		return ""
+	}
+	msg := r.format(line, match)
+	r.last = now
+	r.matches = 0
+	return msg
+}
+
+// LogWatch tail journal and log files and send messages for matching lines
+type LogWatch struct {
+	Message chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLogWatch create and start watching sources from [logwatch] rules
+func NewLogWatch() *LogWatch {
+	l := &LogWatch{
+		Message: make(chan string, 5),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	sources := make(map[string][]*LogWatchRule)
+	var order []string
+	for _, rule := range configuration.LogWatchConf.Rules {
+		if rule.Unit == "" && rule.File == "" {
+			logger.Error("LogWatch: rule without unit and file: ", rule.Pattern)
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			logger.Errorf("LogWatch: invalid pattern '%s': %v", rule.Pattern, err)
+			continue
+		}
+		rule.re = re
+		src := rule.source()
+		if _, ok := sources[src]; !ok {
+			order = append(order, src)
+		}
+		sources[src] = append(sources[src], rule)
+	}
+
+	for _, src := range order {
+		rules := sources[src]
+		l.wg.Add(1)
+		if rules[0].Unit != "" {
+			go l.watchJournal(rules[0].Unit, rules)
+		} else {
+			go l.watchFile(rules[0].File, rules)
+		}
+	}
+	return l
+}
+
+// process line by rules
+func (l *LogWatch) process(line string, rules []*LogWatchRule) {
+	now := time.Now()
+	for _, rule := range rules {
+		if msg := rule.check(line, now); msg != "" {
+			logger.Infof("LogWatch: %s matched: %s", rule.source(), line)
+			select {
+			case l.Message <- msg:
+			case <-l.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// watchJournal follow journal of `unit` by journalctl; restart it on exit
+func (l *LogWatch) watchJournal(unit string, rules []*LogWatchRule) {
+	defer l.wg.Done()
+	logger.Infof("LogWatch: watching journal of %s", unit)
+	for {
+		cmd := exec.CommandContext(l.ctx, "journalctl", "--follow", "--lines=0",
+			"--output=cat", "--unit", unit)
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			logger.Errorf("LogWatch: start journalctl for %s error: %v", unit, err)
+		} else {
+			scanner := bufio.NewScanner(out)
+			for scanner.Scan() {
+				l.process(scanner.Text(), rules)
+			}
+			cmd.Wait()
+		}
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+			logger.Infof("LogWatch: restarting journalctl for %s", unit)
+		}
+	}
+}
+
+// watchFile poll `path` for new lines; file is reopened when rotated
+func (l *LogWatch) watchFile(path string, rules []*LogWatchRule) {
+	defer l.wg.Done()
+	logger.Infof("LogWatch: watching file %s", path)
+
+	var f *os.File
+	var reader *bufio.Reader
+	var partial string
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(logWatchPollInterval)
+	defer ticker.Stop()
+
+	first := true
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err == nil {
+				// skip existing content on start; read rotated file from begin
+				if first {
+					f.Seek(0, io.SeekEnd)
+				}
+				reader = bufio.NewReader(f)
+				partial = ""
+			} else if first {
+				logger.Errorf("LogWatch: open %s error: %v", path, err)
+			}
+			first = false
+		}
+
+		if f != nil {
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					partial += line
+					break
+				}
+				l.process(strings.TrimRight(partial+line, "\r\n"), rules)
+				partial = ""
+			}
+			if logFileRotated(f, path) {
+				logger.Debugf("LogWatch: %s rotated", path)
+				f.Close()
+				f = nil
+			}
+		}
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logFileRotated check is `path` now different file or was truncated
+func logFileRotated(f *os.File, path string) bool {
+	st, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	fst, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	if !os.SameFile(st, fst) {
+		return true
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	return err == nil && st.Size() < pos
+}
+
+// Close stop watching
+func (l *LogWatch) Close() {
+	l.cancel()
+	l.wg.Wait()
+}
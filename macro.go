@@ -0,0 +1,197 @@
+package main
+
+// Macros - named sequences of actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const macroStepTimeout = 30 * time.Second
+
+// MacroConf define named sequence of actions
+type MacroConf struct {
+	Name string
+	// Key run macro when pressed
+	Key string
+	// Steps are control socket commands (ie. "mpd clear", "playlist radio",
+	// "volume 40", "key KEY_OK", "msg Hello") executed in order;
+	// additionally "delay <sec>" wait and "sh <command>" run shell command
+	Steps []string
+}
+
+// Macros run configured macros; steps are sent to main loop by Requests
+type Macros struct {
+	Requests chan *CtlRequest
+
+	mu      sync.Mutex
+	running map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+var macros *Macros
+
+// NewMacros create macros runner
+func NewMacros() *Macros {
+	m := &Macros{
+		Requests: make(chan *CtlRequest),
+		running:  make(map[string]bool),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Find return macro with `name`
+func (m *Macros) Find(name string) *MacroConf {
+	for _, mc := range configuration.Macros {
+		if mc.Name == name {
+			return mc
+		}
+	}
+	return nil
+}
+
+// ForKey return macro bound to `key`
+func (m *Macros) ForKey(key string) *MacroConf {
+	if key == "" {
+		return nil
+	}
+	for _, mc := range configuration.Macros {
+		if mc.Key == key {
+			return mc
+		}
+	}
+	return nil
+}
+
+// Run start macro `name` in background
+func (m *Macros) Run(name string) error {
+	mc := m.Find(name)
+	if mc == nil {
+		return fmt.Errorf("unknown macro '%s'", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running[name] {
+		return fmt.Errorf("macro '%s' already running", name)
+	}
+	m.running[name] = true
+	go m.run(m.ctx, mc)
+	return nil
+}
+
+func (m *Macros) run(ctx context.Context, mc *MacroConf) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, mc.Name)
+		m.mu.Unlock()
+	}()
+
+	log := logger.With("MACRO", mc.Name)
+	log.Infof("Macros: running %s", mc.Name)
+	start := time.Now()
+	for i, step := range mc.Steps {
+		log.Debugf("Macros: %s step %d: %s", mc.Name, i+1, step)
+		if err := m.step(ctx, step); err != nil {
+			log.Errorf("Macros: %s step %d '%s' error: %v", mc.Name, i+1, step, err)
+			return
+		}
+	}
+	log.Infof("Macros: %s done in %s", mc.Name, time.Since(start))
+}
+
+// step execute one step of macro
+func (m *Macros) step(ctx context.Context, step string) error {
+	fields := strings.SplitN(strings.TrimSpace(step), " ", 2)
+	cmd, args := fields[0], ""
+	if len(fields) > 1 {
+		args = strings.TrimSpace(fields[1])
+	}
+
+	switch cmd {
+	case "":
+		return nil
+	case "key":
+		// keys sent faster than minCmdsInterval are ignored
+		if err := macroWait(ctx, minCmdsInterval); err != nil {
+			return err
+		}
+	case "delay":
+		sec, err := strconv.ParseFloat(args, 64)
+		if err != nil || sec < 0 {
+			return errors.New("invalid delay")
+		}
+		return macroWait(ctx, time.Duration(sec*float64(time.Second)))
+	case "sh":
+		ctx, cancel := context.WithTimeout(ctx, macroStepTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "sh", "-c", args).CombinedOutput()
+		logger.Debugf("Macros: sh output: %s", out)
+		return err
+	}
+
+	req := &CtlRequest{Cmd: cmd, Args: args, Result: make(chan string, 1)}
+	select {
+	case m.Requests <- req:
+	case <-ctx.Done():
+		return errors.New("canceled")
+	}
+	var res string
+	select {
+	case res = <-req.Result:
+	case <-ctx.Done():
+		return errors.New("canceled")
+	}
+	if strings.HasPrefix(res, "ERR") {
+		return errors.New(strings.TrimSpace(strings.TrimPrefix(res, "ERR")))
+	}
+	return nil
+}
+
+// macroWait wait `d` or until `ctx` is canceled
+func macroWait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return errors.New("canceled")
+	}
+}
+
+// WebHandler run macro given in path (/macro/<name>); require POST
+func (m *Macros) WebHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/macro/")
+	if err := m.Run(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("OK\n"))
+}
+
+// Reload stop macros started with previous configuration
+func (m *Macros) Reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+}
+
+// Close stop running macros
+func (m *Macros) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+}
@@ -0,0 +1,121 @@
+package main
+
+// Prometheus metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "rpilcd"
+
+// metricsOtherKey is label of keys not defined in configuration
+const metricsOtherKey = "other"
+
+var (
+	metricsKeyEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "key_events_total",
+		Help:      "Number of key events received.",
+	}, []string{"source", "key"})
+
+	metricsCommands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "commands_total",
+		Help:      "Number of commands executed from menu.",
+	}, []string{"item", "exit_code"})
+
+	metricsCommandsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "command_duration_seconds",
+		Help:      "Duration of commands executed from menu.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"item"})
+
+	metricsMPDReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "mpd",
+		Name:      "reconnects_total",
+		Help:      "Number of reconnections to mpd.",
+	})
+
+	metricsMPDErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "mpd",
+		Name:      "errors_total",
+		Help:      "Number of failed mpd commands.",
+	}, []string{"command"})
+
+	metricsUrgentMsgs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "urgent_messages_total",
+		Help:      "Number of urgent messages.",
+	})
+
+	metricsDisplayWrites = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "display",
+		Name:      "line_writes_total",
+		Help:      "Number of lines written to lcd.",
+	})
+
+	metricsDisplaySkips = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "display",
+		Name:      "line_skips_total",
+		Help:      "Number of not changed lines skipped.",
+	})
+
+	metricsPlayerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "player",
+		Name:      "state",
+		Help:      "Current player state (1 for active state).",
+	}, []string{"state"})
+
+	metricsPlayerVolume = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "player",
+		Name:      "volume",
+		Help:      "Current player volume.",
+	})
+)
+
+var metricsPlayerStates = []string{"play", "pause", "stop", "error"}
+
+func init() {
+	prometheus.MustRegister(metricsKeyEvents, metricsCommands,
+		metricsCommandsDuration, metricsMPDReconnects, metricsMPDErrors,
+		metricsUrgentMsgs, metricsDisplayWrites, metricsDisplaySkips,
+		metricsPlayerState, metricsPlayerVolume)
+}
+
+// updatePlayerMetrics set player gauges according to `status`
+func updatePlayerMetrics(status *PlayerStatus) {
+	state := "error"
+	if status != nil && status.Flags != "ERR" && status.Status != "" {
+		state = status.Status
+	}
+	for _, s := range metricsPlayerStates {
+		if s == state {
+			metricsPlayerState.WithLabelValues(s).Set(1)
+		} else {
+			metricsPlayerState.WithLabelValues(s).Set(0)
+		}
+	}
+	if status != nil {
+		if vol, err := strconv.Atoi(status.Volume); err == nil {
+			metricsPlayerVolume.Set(float64(vol))
+		}
+	}
+}
+
+// metricsKeyLabel return `key` when it is defined in configuration; other keys
+// are counted as "other" to keep number of label values bounded
+func metricsKeyLabel(key string) string {
+	if configuration.keyNames[key] {
+		return key
+	}
+	return metricsOtherKey
+}
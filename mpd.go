@@ -1,70 +1,58 @@
 package main
 
 import (
-	"fmt"
+	"errors"
 	"github.com/fhs/gompd/mpd"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
 func mpdConnect() *mpd.Client {
-	con, err := mpd.Dial("tcp", configuration.MPDConf.Host)
+	con, err := mpd.Dial("tcp", mpdHost())
 	if err != nil {
-		logger.Error("mpdConnect error: ", err.Error())
+		mpdError("connect", err)
 	}
 	return con
 }
 
+// mpdError log failed mpd command and count it in metrics
+func mpdError(cmd string, err error) {
+	mpdLog.With("MPD_HOST", mpdHost()).Errorf("MPD.%s error: %v", cmd, err)
+	metricsMPDErrors.WithLabelValues(cmd).Inc()
+}
+
 func connClose(con *mpd.Client) {
 	if con != nil {
 		con.Close()
 	}
 }
 
-// MPDStatus of MPD daemon
-type MPDStatus struct {
-	CurrentSong string
-	Playing     bool
-	Status      string
-	Flags       string
-	Volume      string
-	Error       string
-}
-
-var mpdStatusFree = sync.Pool{
-	New: func() interface{} { return new(MPDStatus) },
-}
-
-func (s *MPDStatus) Free() {
-	mpdStatusFree.Put(s)
-}
-
-func (s *MPDStatus) String() string {
-	return fmt.Sprintf("MPDStatus[Playing=%v Status=%v Flags=%v Volume=%v CurrentSong='%v']",
-		s.Playing, s.Status, s.Flags, s.Volume, s.CurrentSong)
-}
-
-// MPD client
+// MPD client; implements Player
 type MPD struct {
-	Message chan *MPDStatus
-	watcher *mpd.Watcher
-	end     chan bool
-	active  bool
+	messages chan *PlayerStatus
+	// events send mpd subsystems changes that not affect status
+	// (playlist, stored_playlist, output) and "update_done"
+	events   chan string
+	watcher  *mpd.Watcher
+	end      chan bool
+	active   bool
+	updating bool
 }
 
 // NewMPD create new MPD client
 func NewMPD() *MPD {
 	return &MPD{
-		Message: make(chan *MPDStatus, 5),
-		end:     make(chan bool),
-		active:  true,
+		messages: make(chan *PlayerStatus, 5),
+		events:   make(chan string, 5),
+		end:      make(chan bool),
+		active:   true,
 	}
 }
 
 func (m *MPD) watch() (err error) {
-	m.watcher, err = mpd.NewWatcher("tcp", configuration.MPDConf.Host, "")
+	host := mpdHost()
+	m.watcher, err = mpd.NewWatcher("tcp", host, "")
 
 	defer func(w *mpd.Watcher) {
 		if w != nil {
@@ -73,15 +61,19 @@ func (m *MPD) watch() (err error) {
 		m.watcher = nil
 	}(m.watcher)
 
+	log := mpdLog.With("MPD_HOST", host)
 	if err != nil {
-		logger.Errorf("mpd.watch: connect to %v error: %v", configuration.MPDConf.Host, err.Error())
+		log.Errorf("mpd.watch: connect to %v error: %v", host, err.Error())
 		return err
 	}
 
-	logger.Info("mpd.watch: connected to ", configuration.MPDConf.Host)
-	logger.Debugf("mpd.watch: starting watch")
+	log.Info("mpd.watch: connected to ", host)
+	log.Debugf("mpd.watch: starting watch")
 
-	m.Message <- MPDGetStatus()
+	st := MPDGetStatus()
+	m.updating = st.Updating
+	m.messages <- st
+	history.Update()
 
 	for {
 		if m.watcher == nil {
@@ -89,22 +81,32 @@ func (m *MPD) watch() (err error) {
 		}
 		select {
 		case _ = <-m.end:
-			logger.Info("mpd.watch: end")
+			mpdLog.Info("mpd.watch: end")
 			m.active = false
 			return
+		case <-mpdServerChanged:
+			mpdLog.Info("mpd.watch: server changed, reconnecting")
+			return nil
 		case subsystem := <-m.watcher.Event:
-			logger.Debugf("mpd.watch: event: ", subsystem)
-			m.Message <- MPDGetStatus()
-			/*
-				switch subsystem {
-				case "player":
-					m.Message <- MPDGetStatus()
-				default:
-					m.Message <- MPDGetStatus()
+			mpdLog.Debugf("mpd.watch: event: %v", subsystem)
+			switch subsystem {
+			case "player":
+				m.messages <- MPDGetStatus()
+				history.Update()
+			case "mixer", "options":
+				m.messages <- MPDGetStatus()
+			case "update":
+				st := MPDGetStatus()
+				if m.updating && !st.Updating {
+					m.events <- "update_done"
 				}
-			*/
+				m.updating = st.Updating
+				m.messages <- st
+			case "playlist", "stored_playlist", "output":
+				m.events <- subsystem
+			}
 		case err := <-m.watcher.Error:
-			//logger.Errorf("mpd.watch: error event: %v", err)
+			//mpdLog.Errorf("mpd.watch: error event: %v", err)
 			return err
 		}
 	}
@@ -116,7 +118,7 @@ func (m *MPD) watch() (err error) {
 func (m *MPD) Connect() (err error) {
 	go func() {
 		defer func() {
-			logger.Infof("mpd.watch: closing")
+			mpdLog.Infof("mpd.watch: closing")
 			if m.watcher != nil {
 				m.watcher.Close()
 				m.watcher = nil
@@ -124,11 +126,18 @@ func (m *MPD) Connect() (err error) {
 			}
 		}()
 
+		if configuration.MPDConf.Follow && len(mpdServers()) > 1 {
+			go m.follow()
+		}
+
 		for m.active {
 			if err = m.watch(); err != nil {
-				logger.Errorf("mpd.Connect: start watch error: %v", err)
+				mpdLog.Errorf("mpd.Connect: start watch error: %v", err)
 				time.Sleep(5 * time.Second)
 			}
+			if m.active {
+				metricsMPDReconnects.Inc()
+			}
 		}
 	}()
 	return
@@ -136,54 +145,87 @@ func (m *MPD) Connect() (err error) {
 
 // Close MPD client
 func (m *MPD) Close() {
-	logger.Debugln("mpd.Close")
+	mpdLog.Debugln("mpd.Close")
 	if m.watcher != nil {
 		m.end <- true
 	}
 }
 
+// Messages return channel with status changes
+func (m *MPD) Messages() <-chan *PlayerStatus {
+	return m.messages
+}
+
+// Events return channel with other mpd events
+func (m *MPD) Events() <-chan string {
+	return m.events
+}
+
+func (m *MPD) Status() *PlayerStatus            { return MPDGetStatus() }
+func (m *MPD) Play(index int)                   { MPDPlay(index) }
+func (m *MPD) Stop()                            { MPDStop() }
+func (m *MPD) Pause()                           { MPDPause() }
+func (m *MPD) Next()                            { MPDNext() }
+func (m *MPD) Prev()                            { MPDPrev() }
+func (m *MPD) Volume() int                      { return MPDVolume() }
+func (m *MPD) SetVolume(vol int)                { MPDSetVolume(vol) }
+func (m *MPD) Queue() (items []string, pos int) { return MPDCurrPlaylist() }
+func (m *MPD) Playlists() []string              { return MPDPlaylists() }
+func (m *MPD) PlayPlaylist(playlist string)     { MPDPlayPlaylist(playlist) }
+func (m *MPD) PlayURL(url string)               { MPDPlayURL(url) }
+func (m *MPD) ToggleRandom()                    { MPDRandom() }
+func (m *MPD) ToggleRepeat()                    { MPDRepeat() }
+func (m *MPD) ToggleConsume()                   { MPDConsume() }
+func (m *MPD) ToggleSingle()                    { MPDSingle() }
+
+// Ping check connection to mpd
+func (m *MPD) Ping() error {
+	con, err := mpd.Dial("tcp", mpdHost())
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+	return con.Ping()
+}
+
 // GetStatus connect to mpd and get current status
-func MPDGetStatus() (s *MPDStatus) {
-	s = mpdStatusFree.Get().(*MPDStatus)
-	s.Flags = "ERR"
+func MPDGetStatus() (s *PlayerStatus) {
+	s = playerStatusFree.Get().(*PlayerStatus)
+	*s = PlayerStatus{Flags: "ERR", Server: mpdServerName()}
 
 	con := mpdConnect()
 	if con == nil {
 		return
 	}
-	logger.Debugln("mpd.GetStatus: connected to ", configuration.MPDConf.Host)
+	mpdLog.Debugln("mpd.GetStatus: connected to ", mpdHost())
 
 	defer connClose(con)
 
 	status, err := con.Status()
 	if err != nil {
-		logger.Errorf("mpd.GetStatus: Status error: %v", err.Error())
+		mpdError("Status", err)
 		return
 	}
 
 	s.Status = status["state"]
 	s.Playing = s.Status != "stop"
-	if s.Playing {
-		s.Flags = ""
-	} else {
+	if !s.Playing {
 		s.Error = status["error"]
 	}
 	s.Volume = status["volume"]
-
-	if status["random"] != "0" {
-		s.Flags = "S"
-	} else if status["repeat"] != "0" {
-		s.Flags = "R"
-	}
+	s.Flags = mpdFlags(status)
+	_, s.Updating = status["updating_db"]
+	s.Elapsed, _ = strconv.ParseFloat(status["elapsed"], 64)
+	s.Duration, _ = strconv.ParseFloat(status["duration"], 64)
 
 	song, err := con.CurrentSong()
 	if err != nil {
-		logger.Errorf("mpd.GetStatus: CurrentSong error: %v", err.Error())
+		mpdError("CurrentSong", err)
 		return
 	}
 
-	//logger.Infof("Status: %+v", status)
-	//logger.Infof("Song: %+v", song)
+	//mpdLog.Infof("Status: %+v", status)
+	//mpdLog.Infof("Song: %+v", song)
 
 	var res []string
 
@@ -220,6 +262,23 @@ func MPDGetStatus() (s *MPDStatus) {
 	}
 
 	s.CurrentSong = strings.Join(res, "; ")
+	s.Artist = song["Artist"]
+	s.Album = song["Album"]
+	s.File = song["file"]
+
+	if file := song["file"]; isStream(file) {
+		s.Stream = true
+		s.StationName = stationName(file)
+		if s.StationName == "" {
+			s.StationName = song["Name"]
+		}
+		if s.StationName == "" {
+			s.StationName = file
+		}
+		s.Title = streamTitle(song["Artist"], song["Title"])
+	} else {
+		s.Title = song["Title"]
+	}
 	return
 }
 
@@ -265,33 +324,40 @@ func MPDPrev() {
 	}
 }
 
-func changeVol(change int) {
+// MPDVolume return current volume; -1 on error
+func MPDVolume() int {
 	con := mpdConnect()
 	if con == nil {
-		return
+		return -1
 	}
 	defer connClose(con)
-	if stat, err := con.Status(); err == nil {
-		vol, err := strconv.Atoi(stat["volume"])
-		if err != nil {
-			return
-		}
-		vol += change
-		if vol > 100 {
-			vol = 100
-		} else if vol < 0 {
-			vol = 0
-		}
-		con.SetVolume(vol)
+	stat, err := con.Status()
+	if err != nil {
+		mpdError("Volume", err)
+		return -1
 	}
+	vol, err := strconv.Atoi(stat["volume"])
+	if err != nil {
+		return -1
+	}
+	return vol
 }
 
-func MPDVolUp() {
-	changeVol(5)
-}
-
-func MPDVolDown() {
-	changeVol(-5)
+// MPDSetVolume set volume to `vol`
+func MPDSetVolume(vol int) {
+	if vol < 0 {
+		return
+	}
+	if vol > 100 {
+		vol = 100
+	}
+	con := mpdConnect()
+	if con != nil {
+		defer connClose(con)
+		if err := con.SetVolume(vol); err != nil {
+			mpdError("SetVolume", err)
+		}
+	}
 }
 
 func MPDPlaylists() (pls []string) {
@@ -304,7 +370,7 @@ func MPDPlaylists() (pls []string) {
 				pls = append(pls, pl["playlist"])
 			}
 		} else {
-			logger.Error("MPD.Playlists list error: ", err)
+			mpdError("Playlists", err)
 		}
 	}
 	return
@@ -320,6 +386,34 @@ func MPDPlayPlaylist(playlist string) {
 	}
 }
 
+// MPDSavePlaylist save current queue as playlist `name`
+func MPDSavePlaylist(name string) bool {
+	con := mpdConnect()
+	if con == nil {
+		return false
+	}
+	defer connClose(con)
+	if err := con.PlaylistSave(name); err != nil {
+		mpdError("SavePlaylist", err)
+		return false
+	}
+	return true
+}
+
+// MPDPlayURL replace current playlist by `url` and play it
+func MPDPlayURL(url string) {
+	con := mpdConnect()
+	if con != nil {
+		defer connClose(con)
+		con.Clear()
+		if err := con.Add(url); err != nil {
+			mpdError("PlayURL", err)
+			return
+		}
+		con.Play(0)
+	}
+}
+
 func MPDCurrPlaylist() (pls []string, pos int) {
 	con := mpdConnect()
 	if con == nil {
@@ -331,49 +425,53 @@ func MPDCurrPlaylist() (pls []string, pos int) {
 	}
 	playlists, err := con.PlaylistInfo(-1, -1)
 	if err != nil {
-		logger.Error("MPD.CurrPlaylist list error: ", err)
+		mpdError("CurrPlaylist", err)
 		return
 	}
 	for _, pl := range playlists {
-		if title, ok := pl["Title"]; ok {
-			pls = append(pls, title)
-		} else {
-			pls = append(pls, pl["file"])
-		}
+		pls = append(pls, songLabel(pl))
 	}
 	return
 }
 
-var preMuteVol = -1
+func songLabel(song mpd.Attrs) string {
+	if title, ok := song["Title"]; ok {
+		return title
+	}
+	return song["file"]
+}
 
-func MPDVolMute() {
+func (m *MPD) QueueLen() (items, pos int) {
 	con := mpdConnect()
 	if con == nil {
 		return
 	}
 	defer connClose(con)
-
 	stat, err := con.Status()
 	if err != nil {
-		logger.Error("MPD.MPDVolMute error: ", err)
+		mpdError("QueueLen", err)
 		return
 	}
+	items, _ = strconv.Atoi(stat["playlistlength"])
+	pos, _ = strconv.Atoi(stat["song"])
+	return
+}
 
-	vol, err := strconv.Atoi(stat["volume"])
+func (m *MPD) QueueItems(start, end int) (pls []string) {
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+	songs, err := con.PlaylistInfo(start, end)
 	if err != nil {
+		mpdError("QueueItems", err)
 		return
 	}
-
-	if vol == 0 {
-		if preMuteVol > 0 {
-			con.SetVolume(preMuteVol)
-		} else {
-			con.SetVolume(100)
-		}
-	} else {
-		preMuteVol = vol
-		con.SetVolume(0)
+	for _, song := range songs {
+		pls = append(pls, songLabel(song))
 	}
+	return
 }
 
 // MPDRepeat toggle mpd repeat flag
@@ -386,13 +484,13 @@ func MPDRepeat() {
 
 	stat, err := con.Status()
 	if err != nil {
-		logger.Error("MPD.MPDRepeat error: ", err)
+		mpdError("Repeat", err)
 		return
 	}
 
 	repeat := stat["repeat"]
 	if err = con.Repeat(repeat == "0"); err != nil {
-		logger.Error("MPD.MPDRepeat error: ", err)
+		mpdError("Repeat", err)
 	}
 }
 
@@ -406,12 +504,220 @@ func MPDRandom() {
 
 	stat, err := con.Status()
 	if err != nil {
-		logger.Error("MPD.MPDRandom error: ", err)
+		mpdError("Random", err)
 		return
 	}
 
-	random := stat["repeat"]
+	random := stat["random"]
 	if err = con.Random(random == "0"); err != nil {
-		logger.Error("MPD.MPDRandom error: ", err)
+		mpdError("Random", err)
+	}
+}
+
+// mpdFlags return compact representation of active mpd options:
+// R - repeat, S - random (shuffle), 1 - single, C - consume, X - crossfade
+func mpdFlags(status mpd.Attrs) string {
+	flags := make([]byte, 0, 5)
+	if status["repeat"] == "1" {
+		flags = append(flags, 'R')
+	}
+	if status["random"] == "1" {
+		flags = append(flags, 'S')
+	}
+	if status["single"] == "1" {
+		flags = append(flags, '1')
+	}
+	if status["consume"] == "1" {
+		flags = append(flags, 'C')
+	}
+	if xfade, ok := status["xfade"]; ok && xfade != "0" {
+		flags = append(flags, 'X')
+	}
+	return string(flags)
+}
+
+// MPDOption return current value of mpd status field `name`
+func MPDOption(name string) string {
+	con := mpdConnect()
+	if con == nil {
+		return ""
+	}
+	defer connClose(con)
+
+	stat, err := con.Status()
+	if err != nil {
+		mpdError("Option", err)
+		return ""
+	}
+	return stat[name]
+}
+
+// MPDConsume toggle consume flag; return new state
+func MPDConsume() bool {
+	con := mpdConnect()
+	if con == nil {
+		return false
+	}
+	defer connClose(con)
+
+	stat, err := con.Status()
+	if err != nil {
+		mpdError("Consume", err)
+		return false
+	}
+
+	consume := stat["consume"] == "0"
+	if err = con.Consume(consume); err != nil {
+		mpdError("Consume", err)
+	}
+	return consume
+}
+
+// MPDSingle toggle single flag; return new state
+func MPDSingle() bool {
+	con := mpdConnect()
+	if con == nil {
+		return false
+	}
+	defer connClose(con)
+
+	stat, err := con.Status()
+	if err != nil {
+		mpdError("Single", err)
+		return false
+	}
+
+	single := stat["single"] == "0"
+	if err = con.Single(single); err != nil {
+		mpdError("Single", err)
+	}
+	return single
+}
+
+// MPDSetCrossfade set crossfade to `sec` seconds
+func MPDSetCrossfade(sec int) {
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+
+	if err := con.Command("crossfade %d", sec).OK(); err != nil {
+		mpdError("SetCrossfade", err)
+	}
+}
+
+// MPDReplayGainMode return current replay gain mode
+func MPDReplayGainMode() string {
+	con := mpdConnect()
+	if con == nil {
+		return ""
+	}
+	defer connClose(con)
+
+	attrs, err := con.Command("replay_gain_status").Attrs()
+	if err != nil {
+		mpdError("ReplayGainMode", err)
+		return ""
+	}
+	return attrs["replay_gain_mode"]
+}
+
+// MPDCommand execute raw mpd command `cmd` with `args`; each arg is quoted
+// when sent to mpd so it may contain spaces
+func MPDCommand(cmd string, args ...string) error {
+	// line breaks would start next command
+	if cmd == "" || strings.ContainsAny(cmd, " \t\r\n") {
+		return errors.New("invalid mpd command '" + cmd + "'")
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\r\n") {
+			return errors.New("line break in mpd command argument")
+		}
+	}
+
+	con := mpdConnect()
+	if con == nil {
+		return errors.New("not connected")
+	}
+	defer connClose(con)
+
+	// only args are formatted; escape cmd used as format
+	format := strings.Replace(cmd, "%", "%%", -1)
+	var iargs []interface{}
+	for _, arg := range args {
+		format += " %s"
+		iargs = append(iargs, arg)
+	}
+	if err := con.Command(format, iargs...).OK(); err != nil {
+		mpdError("Command", err)
+		return err
+	}
+	return nil
+}
+
+// MPDSetReplayGainMode set replay gain mode (off, track, album, auto)
+func MPDSetReplayGainMode(mode string) {
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+
+	if err := con.Command("replay_gain_mode %s", mode).OK(); err != nil {
+		mpdError("SetReplayGainMode", err)
+	}
+}
+
+// MPDOutput describe one mpd audio output
+type MPDOutput struct {
+	ID      int
+	Name    string
+	Enabled bool
+}
+
+// MPDOutputs return list of mpd audio outputs
+func MPDOutputs() (outputs []MPDOutput) {
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+
+	attrs, err := con.ListOutputs()
+	if err != nil {
+		mpdError("Outputs", err)
+		return
+	}
+	for _, a := range attrs {
+		id, err := strconv.Atoi(a["outputid"])
+		if err != nil {
+			continue
+		}
+		outputs = append(outputs, MPDOutput{
+			ID:      id,
+			Name:    a["outputname"],
+			Enabled: a["outputenabled"] == "1",
+		})
+	}
+	return
+}
+
+// MPDSetOutput enable or disable output `id`
+func MPDSetOutput(id int, enabled bool) {
+	con := mpdConnect()
+	if con == nil {
+		return
+	}
+	defer connClose(con)
+
+	var err error
+	if enabled {
+		err = con.EnableOutput(id)
+	} else {
+		err = con.DisableOutput(id)
+	}
+	if err != nil {
+		mpdError("SetOutput", err)
 	}
 }
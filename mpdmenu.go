@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strconv"
+)
+
+var (
+	crossfadeValues  = []int{0, 2, 5, 10}
+	replayGainModes  = []string{"off", "track", "album", "auto"}
+	onOffLabels      = map[bool]string{true: "on", false: "off"}
+	outputStateLabel = map[bool]string{true: "[x] ", false: "[ ] "}
+)
+
+// executeMPD handle menu items of "mpd" kind
+func (t *MenuItem) executeMPD() (result int, screen Screen) {
+	switch t.Cmd {
+	case "playlists":
+		return ActionResultOk, NewMPDPlaylistsScreen()
+	case "playlist":
+		return ActionResultOk, NewMPDCurrPlaylistScreen()
+	case "servers":
+		return ActionResultOk, NewMPDServersScreen()
+	case "history":
+		return ActionResultOk, NewHistoryScreen()
+	case "save":
+		if len(t.Args) == 0 || t.Args[0] == "" {
+			return ActionResultOk, NewTextInputScreen("playlist name:", "", func(name string) (int, Screen) {
+				if name == "" {
+					return ActionResultBack, nil
+				}
+				return mpdSaveResult(name)
+			})
+		}
+		return mpdSaveResult(t.Args[0])
+	case "outputs":
+		return ActionResultOk, NewMPDOutputsScreen()
+	case "crossfade":
+		if len(t.Args) == 0 {
+			return ActionResultOk, mpdCrossfadeMenu()
+		}
+		sec, err := strconv.Atoi(t.Args[0])
+		if err != nil {
+			break
+		}
+		MPDSetCrossfade(sec)
+		return ActionResultOk, &TextScreen{Lines: []string{"crossfade " + t.Args[0] + "s"}, Timeout: 2}
+	case "replay_gain":
+		if len(t.Args) == 0 {
+			return ActionResultOk, mpdReplayGainMenu()
+		}
+		MPDSetReplayGainMode(t.Args[0])
+		return ActionResultOk, &TextScreen{Lines: []string{"replay gain " + t.Args[0]}, Timeout: 2}
+	case "consume":
+		return ActionResultOk, &TextScreen{Lines: []string{"consume " + onOffLabels[MPDConsume()]}, Timeout: 2}
+	case "single":
+		return ActionResultOk, &TextScreen{Lines: []string{"single " + onOffLabels[MPDSingle()]}, Timeout: 2}
+	case "random":
+		MPDRandom()
+		return ActionResultOk, &TextScreen{Lines: []string{"random " + onOffLabels[MPDOption("random") == "1"]}, Timeout: 2}
+	case "repeat":
+		MPDRepeat()
+		return ActionResultOk, &TextScreen{Lines: []string{"repeat " + onOffLabels[MPDOption("repeat") == "1"]}, Timeout: 2}
+	}
+	return ActionResultNop, nil
+}
+
+// outputsSource list mpd outputs as items of ListScreen
+type outputsSource []MPDOutput
+
+func (o outputsSource) Len() int {
+	return len(o)
+}
+
+func (o outputsSource) Labels(start, end int) (res []string) {
+	for _, out := range o[start:end] {
+		res = append(res, outputStateLabel[out.Enabled]+out.Name)
+	}
+	return
+}
+
+// NewMPDOutputsScreen create screen with mpd outputs; selecting output toggle it
+func NewMPDOutputsScreen() *ListScreen {
+	l := &ListScreen{
+		Source:   outputsSource(MPDOutputs()),
+		Empty:    "No outputs",
+		ReloadOn: "output",
+	}
+	l.Reload = func() {
+		l.Source = outputsSource(MPDOutputs())
+	}
+	l.OnSelect = func(idx int) (int, Screen) {
+		outputs := l.Source.(outputsSource)
+		outputs[idx].Enabled = !outputs[idx].Enabled
+		MPDSetOutput(outputs[idx].ID, outputs[idx].Enabled)
+		return ActionResultOk, nil
+	}
+	return l
+}
+
+func mpdSaveResult(name string) (result int, screen Screen) {
+	if !MPDSavePlaylist(name) {
+		return ActionResultOk, &TextScreen{Lines: []string{"save failed"}, Timeout: 2}
+	}
+	return ActionResultOk, &TextScreen{Lines: []string{"saved " + name}, Timeout: 2}
+}
+
+// mpdCrossfadeMenu create menu with predefined crossfade values
+func mpdCrossfadeMenu() Screen {
+	curr := MPDOption("xfade")
+	if curr == "" {
+		curr = "0"
+	}
+	var values []string
+	for _, v := range crossfadeValues {
+		values = append(values, strconv.Itoa(v))
+	}
+	return NewChoiceScreen(values, curr, func(val string) string {
+		return val + "s"
+	}, func(val string) {
+		sec, _ := strconv.Atoi(val)
+		MPDSetCrossfade(sec)
+	})
+}
+
+// mpdReplayGainMenu create menu with replay gain modes
+func mpdReplayGainMenu() Screen {
+	return NewChoiceScreen(replayGainModes, MPDReplayGainMode(), nil,
+		MPDSetReplayGainMode)
+}
@@ -0,0 +1,135 @@
+package main
+
+// Support for multiple mpd servers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fhs/gompd/mpd"
+)
+
+const defaultFollowInterval = 10
+
+// MPDServer is one configured mpd server
+type MPDServer struct {
+	Name string
+	Host string
+}
+
+var (
+	mpdActiveMu sync.RWMutex
+	mpdActive   *MPDServer
+	// mpdServerChanged notify watcher about switching server
+	mpdServerChanged = make(chan bool, 1)
+)
+
+// mpdServers return all configured servers
+func mpdServers() []*MPDServer {
+	if len(configuration.MPDConf.Servers) > 0 {
+		return configuration.MPDConf.Servers
+	}
+	return []*MPDServer{{Host: configuration.MPDConf.Host}}
+}
+
+// mpdActiveServer return currently used server
+func mpdActiveServer() *MPDServer {
+	mpdActiveMu.RLock()
+	defer mpdActiveMu.RUnlock()
+
+	if mpdActive != nil {
+		return mpdActive
+	}
+	return mpdServers()[0]
+}
+
+// mpdHost return address of active mpd server
+func mpdHost() string {
+	return mpdActiveServer().Host
+}
+
+// mpdServerName return name of active server when more than one server is
+// configured
+func mpdServerName() string {
+	if len(configuration.MPDConf.Servers) < 2 {
+		return ""
+	}
+	return mpdActiveServer().Name
+}
+
+// MPDSwitchServer change active mpd server; return false when server not found
+func MPDSwitchServer(name string) bool {
+	for _, srv := range mpdServers() {
+		if srv.Name != name {
+			continue
+		}
+		changed := mpdActiveServer().Name != srv.Name
+		mpdActiveMu.Lock()
+		mpdActive = srv
+		mpdActiveMu.Unlock()
+
+		if changed {
+			mpdLog.Infof("MPDSwitchServer: switched to %s (%s)", srv.Name, srv.Host)
+			select {
+			case mpdServerChanged <- true:
+			default:
+			}
+		}
+		return true
+	}
+	mpdLog.Errorf("MPDSwitchServer: unknown server %s", name)
+	return false
+}
+
+// serverState return state of mpd on `host`
+func serverState(host string) string {
+	con, err := mpd.Dial("tcp", host)
+	if err != nil {
+		return ""
+	}
+	defer con.Close()
+
+	status, err := con.Status()
+	if err != nil {
+		return ""
+	}
+	return status["state"]
+}
+
+// follow periodically check servers and switch to playing one when active
+// server is not playing
+func (m *MPD) follow() {
+	interval := configuration.MPDConf.FollowInterval
+	if interval <= 0 {
+		interval = defaultFollowInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for m.active {
+		<-ticker.C
+		active := mpdActiveServer()
+		if serverState(active.Host) == "play" {
+			continue
+		}
+		for _, srv := range mpdServers() {
+			if srv.Name != active.Name && serverState(srv.Host) == "play" {
+				mpdLog.Infof("mpd.follow: %s is playing", srv.Name)
+				MPDSwitchServer(srv.Name)
+				break
+			}
+		}
+	}
+}
+
+// NewMPDServersScreen create screen with mpd servers; selecting item switch
+// server
+func NewMPDServersScreen() *ListScreen {
+	var names []string
+	for _, srv := range mpdServers() {
+		names = append(names, srv.Name)
+	}
+	return NewChoiceScreen(names, mpdActiveServer().Name, nil, func(name string) {
+		MPDSwitchServer(name)
+	})
+}
@@ -0,0 +1,328 @@
+package main
+
+// MPRIS D-Bus interface (org.mpris.MediaPlayer2)
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisPath        = "/org/mpris/MediaPlayer2"
+	mprisIface       = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+	mprisNoTrack     = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+	defaultMPRISName = "rpilcd"
+)
+
+// mprisRoot implements org.mpris.MediaPlayer2
+type mprisRoot struct{}
+
+func (mprisRoot) Raise() *dbus.Error { return nil }
+func (mprisRoot) Quit() *dbus.Error  { return nil }
+
+// mprisPlayer implements org.mpris.MediaPlayer2.Player
+type mprisPlayer struct{}
+
+// mprisPlayerMethods map go method names to dbus names
+var mprisPlayerMethods = map[string]string{"SeekOffset": "Seek"}
+
+func (mprisPlayer) Next() *dbus.Error     { player.Next(); return nil }
+func (mprisPlayer) Previous() *dbus.Error { player.Prev(); return nil }
+func (mprisPlayer) Stop() *dbus.Error     { player.Stop(); return nil }
+
+// Pause have no effect when player is not playing
+func (mprisPlayer) Pause() *dbus.Error {
+	st := player.Status()
+	defer st.Free()
+	if st.Status == "play" {
+		player.Pause()
+	}
+	return nil
+}
+
+// Play resume paused player or start stopped; have no effect when playing
+func (mprisPlayer) Play() *dbus.Error {
+	st := player.Status()
+	defer st.Free()
+	switch st.Status {
+	case "pause":
+		player.Pause()
+	case "stop":
+		player.Play(-1)
+	}
+	return nil
+}
+
+func (mprisPlayer) PlayPause() *dbus.Error {
+	st := player.Status()
+	defer st.Free()
+	if st.Status == "stop" {
+		player.Play(-1)
+	} else {
+		player.Pause()
+	}
+	return nil
+}
+
+// SeekOffset (exported as Seek) is not supported
+func (mprisPlayer) SeekOffset(offset int64) *dbus.Error { return nil }
+
+// SetPosition is not supported
+func (mprisPlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	return nil
+}
+
+func (mprisPlayer) OpenUri(uri string) *dbus.Error {
+	player.PlayURL(uri)
+	return nil
+}
+
+// mprisProps serve properties; Position is computed on each Get and
+// PropertiesChanged is never emitted for it
+type mprisProps struct {
+	*prop.Properties
+	m *MPRIS
+}
+
+func (p mprisProps) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	if iface == mprisPlayerIface && property == "Position" {
+		return dbus.MakeVariant(p.m.position()), nil
+	}
+	return p.Properties.Get(iface, property)
+}
+
+func (p mprisProps) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	res, err := p.Properties.GetAll(iface)
+	if err == nil && iface == mprisPlayerIface {
+		res["Position"] = dbus.MakeVariant(p.m.position())
+	}
+	return res, err
+}
+
+// MPRIS expose player on D-Bus
+type MPRIS struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+	// track number and file used for mpris:trackid
+	track     int
+	trackFile string
+
+	// position of current song reported by last status
+	mu       sync.Mutex
+	elapsed  float64
+	duration float64
+	playing  bool
+	updated  time.Time
+}
+
+// Start connect to bus configured in [mpris] and register service
+func (m *MPRIS) Start() error {
+	conf := configuration.MPRISConf
+	var err error
+	switch conf.Bus {
+	case "system":
+		m.conn, err = dbus.ConnectSystemBus()
+	case "session":
+		m.conn, err = dbus.ConnectSessionBus()
+	default:
+		err = fmt.Errorf("unknown bus '%s'", conf.Bus)
+	}
+	if err != nil {
+		logger.Error("MPRIS.Start connect error: ", err.Error())
+		return err
+	}
+
+	m.props, err = prop.Export(m.conn, mprisPath, prop.Map{
+		mprisIface: {
+			"CanQuit":             {Value: false, Emit: prop.EmitConst},
+			"CanRaise":            {Value: false, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: "rpilcd", Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{"http", "https"}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitConst},
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": {Value: "Stopped", Emit: prop.EmitTrue},
+			"LoopStatus":     {Value: "None", Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Emit: prop.EmitTrue},
+			"Shuffle":        {Value: false, Emit: prop.EmitTrue},
+			"Metadata":       {Value: map[string]dbus.Variant{}, Emit: prop.EmitTrue},
+			"Volume": {Value: 0.0, Emit: prop.EmitTrue, Writable: true,
+				Callback: func(c *prop.Change) *dbus.Error {
+					vol, _ := c.Value.(float64)
+					if vol < 0 {
+						vol = 0
+					} else if vol > 1 {
+						vol = 1
+					}
+					player.SetVolume(int(vol*100 + 0.5))
+					return nil
+				}},
+			// Position is served by mprisProps.Get
+			"Position":      {Value: int64(0), Emit: prop.EmitFalse},
+			"MinimumRate":   {Value: 1.0, Emit: prop.EmitConst},
+			"MaximumRate":   {Value: 1.0, Emit: prop.EmitConst},
+			"CanGoNext":     {Value: true, Emit: prop.EmitConst},
+			"CanGoPrevious": {Value: true, Emit: prop.EmitConst},
+			"CanPlay":       {Value: true, Emit: prop.EmitConst},
+			"CanPause":      {Value: true, Emit: prop.EmitConst},
+			"CanSeek":       {Value: false, Emit: prop.EmitConst},
+			"CanControl":    {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		logger.Error("MPRIS.Start export properties error: ", err.Error())
+		m.conn.Close()
+		return err
+	}
+
+	m.conn.Export(mprisProps{m.props, m}, mprisPath, "org.freedesktop.DBus.Properties")
+	m.conn.Export(mprisRoot{}, mprisPath, mprisIface)
+	m.conn.ExportWithMap(mprisPlayer{}, mprisPlayerMethods, mprisPath, mprisPlayerIface)
+	playerMethods := introspect.Methods(mprisPlayer{})
+	for i, method := range playerMethods {
+		if name, ok := mprisPlayerMethods[method.Name]; ok {
+			playerMethods[i].Name = name
+		}
+	}
+	node := &introspect.Node{
+		Name: mprisPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       mprisIface,
+				Methods:    introspect.Methods(mprisRoot{}),
+				Properties: m.props.Introspection(mprisIface),
+			},
+			{
+				Name:       mprisPlayerIface,
+				Methods:    playerMethods,
+				Properties: m.props.Introspection(mprisPlayerIface),
+			},
+		},
+	}
+	m.conn.Export(introspect.NewIntrospectable(node), mprisPath,
+		"org.freedesktop.DBus.Introspectable")
+
+	name := conf.Name
+	if name == "" {
+		name = defaultMPRISName
+	}
+	reply, err := m.conn.RequestName(mprisIface+"."+name, dbus.NameFlagDoNotQueue)
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		err = errors.New("name already taken")
+	}
+	if err != nil {
+		logger.Error("MPRIS.Start request name error: ", err.Error())
+		m.conn.Close()
+		m.conn = nil
+		return err
+	}
+	logger.Infof("MPRIS.Start registered as %s.%s", mprisIface, name)
+	return nil
+}
+
+// set change property and emit PropertiesChanged when value changed
+func (m *MPRIS) set(property string, value interface{}) {
+	if reflect.DeepEqual(m.props.GetMust(mprisPlayerIface, property), value) {
+		return
+	}
+	m.props.SetMust(mprisPlayerIface, property, value)
+}
+
+// Update properties according to player status
+func (m *MPRIS) Update(s *PlayerStatus) {
+	if m.conn == nil || s == nil {
+		return
+	}
+
+	switch s.Status {
+	case "play":
+		m.set("PlaybackStatus", "Playing")
+	case "pause":
+		m.set("PlaybackStatus", "Paused")
+	default:
+		m.set("PlaybackStatus", "Stopped")
+	}
+	if strings.Contains(s.Flags, "R") {
+		m.set("LoopStatus", "Playlist")
+	} else {
+		m.set("LoopStatus", "None")
+	}
+	m.set("Shuffle", strings.Contains(s.Flags, "S"))
+
+	if vol, err := strconv.Atoi(s.Volume); err == nil && vol >= 0 {
+		m.set("Volume", float64(vol)/100)
+	}
+	m.mu.Lock()
+	m.elapsed, m.duration = s.Elapsed, s.Duration
+	m.playing = s.Status == "play"
+	m.updated = time.Now()
+	m.mu.Unlock()
+	m.set("Metadata", m.metadata(s))
+}
+
+// position return current position in microseconds
+func (m *MPRIS) position() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pos := m.elapsed
+	if m.playing {
+		pos += time.Since(m.updated).Seconds()
+		if m.duration > 0 && pos > m.duration {
+			pos = m.duration
+		}
+	}
+	return int64(pos * 1e6)
+}
+
+func (m *MPRIS) metadata(s *PlayerStatus) map[string]dbus.Variant {
+	md := map[string]dbus.Variant{}
+	if s.Status == "stop" || s.File == "" {
+		md["mpris:trackid"] = dbus.MakeVariant(dbus.ObjectPath(mprisNoTrack))
+		return md
+	}
+	if s.File != m.trackFile {
+		m.track++
+		m.trackFile = s.File
+	}
+	md["mpris:trackid"] = dbus.MakeVariant(dbus.ObjectPath(fmt.Sprintf("/org/rpilcd/track/%d", m.track)))
+	md["xesam:url"] = dbus.MakeVariant(s.File)
+	if s.Duration > 0 {
+		md["mpris:length"] = dbus.MakeVariant(int64(s.Duration * 1e6))
+	}
+	title := s.Title
+	if title == "" {
+		title = s.CurrentSong
+	}
+	md["xesam:title"] = dbus.MakeVariant(title)
+	artist := s.Artist
+	if s.Stream {
+		artist = s.StationName
+	}
+	if artist != "" {
+		md["xesam:artist"] = dbus.MakeVariant([]string{artist})
+	}
+	if s.Album != "" {
+		md["xesam:album"] = dbus.MakeVariant(s.Album)
+	}
+	return md
+}
+
+// Close release bus connection
+func (m *MPRIS) Close() {
+	if m.conn != nil {
+		m.conn.Close()
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakePlayer record called actions
+type fakePlayer struct {
+	mu      sync.Mutex
+	status  string
+	actions []string
+}
+
+func (f *fakePlayer) record(action string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, action)
+}
+
+func (f *fakePlayer) setStatus(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakePlayer) called() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := strings.Join(f.actions, ",")
+	f.actions = nil
+	return res
+}
+
+func (f *fakePlayer) Connect() error                   { return nil }
+func (f *fakePlayer) Close()                           {}
+func (f *fakePlayer) Messages() <-chan *PlayerStatus   { return nil }
+func (f *fakePlayer) Events() <-chan string            { return nil }
+func (f *fakePlayer) Ping() error                      { return nil }
+func (f *fakePlayer) Play(index int)                   { f.record("play") }
+func (f *fakePlayer) Stop()                            { f.record("stop") }
+func (f *fakePlayer) Pause()                           { f.record("pause") }
+func (f *fakePlayer) Next()                            { f.record("next") }
+func (f *fakePlayer) Prev()                            { f.record("prev") }
+func (f *fakePlayer) Volume() int                      { return 50 }
+func (f *fakePlayer) SetVolume(vol int)                { f.record("volume " + strconv.Itoa(vol)) }
+func (f *fakePlayer) ToggleRandom()                    { f.record("random") }
+func (f *fakePlayer) ToggleRepeat()                    { f.record("repeat") }
+func (f *fakePlayer) Queue() (items []string, pos int) { return nil, -1 }
+func (f *fakePlayer) Playlists() []string              { return nil }
+func (f *fakePlayer) PlayPlaylist(playlist string)     { f.record("playlist") }
+func (f *fakePlayer) PlayURL(url string)               { f.record("url") }
+
+func (f *fakePlayer) Status() *PlayerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &PlayerStatus{Status: f.status}
+}
+
+// startDBus run private session bus; return its address
+func startDBus(t *testing.T) string {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	addr := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address=1",
+		"--address="+addr)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	// daemon print address when ready
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(line)
+}
+
+func TestMPRIS(t *testing.T) {
+	addr := startDBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	configuration = &Configuration{}
+	configuration.MPRISConf.Bus = "session"
+	configuration.MPRISConf.Name = "test"
+	fp := &fakePlayer{status: "play"}
+	player = fp
+
+	m := &MPRIS{}
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.Update(&PlayerStatus{Status: "play", File: "a.mp3", Title: "A", Elapsed: 10, Duration: 100, Volume: "50"})
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface("org.freedesktop.DBus.Properties")); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+
+	obj := conn.Object(mprisIface+".test", mprisPath)
+	call := func(method string) {
+		t.Helper()
+		if err := obj.Call(mprisPlayerIface+"."+method, 0).Err; err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+	}
+
+	// Pause pause only playing player; Play resume only paused or stopped
+	call("Pause")
+	if res := fp.called(); res != "pause" {
+		t.Errorf("Pause when playing called %q", res)
+	}
+	fp.setStatus("pause")
+	call("Pause")
+	if res := fp.called(); res != "" {
+		t.Errorf("Pause when paused called %q", res)
+	}
+	call("Play")
+	if res := fp.called(); res != "pause" {
+		t.Errorf("Play when paused called %q", res)
+	}
+	fp.setStatus("stop")
+	call("Play")
+	if res := fp.called(); res != "play" {
+		t.Errorf("Play when stopped called %q", res)
+	}
+	fp.setStatus("play")
+	call("Play")
+	if res := fp.called(); res != "" {
+		t.Errorf("Play when playing called %q", res)
+	}
+
+	// volume set by client is clamped to 0..1
+	for vol, want := range map[float64]string{3: "volume 100", -0.5: "volume 0", 0.4: "volume 40"} {
+		if err := obj.SetProperty(mprisPlayerIface+".Volume", dbus.MakeVariant(vol)); err != nil {
+			t.Fatal(err)
+		}
+		if res := fp.called(); res != want {
+			t.Errorf("Volume %v called %q", vol, res)
+		}
+	}
+
+	// Position is computed from last status
+	v, err := obj.GetProperty(mprisPlayerIface + ".Position")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, ok := v.Value().(int64); !ok || pos < 10e6 || pos > 12e6 {
+		t.Errorf("Position = %v", v.Value())
+	}
+
+	// position change must not emit PropertiesChanged
+	for len(signals) > 0 {
+		<-signals
+	}
+	m.Update(&PlayerStatus{Status: "play", File: "a.mp3", Title: "A", Elapsed: 20, Duration: 100, Volume: "50"})
+	m.Update(&PlayerStatus{Status: "pause", File: "a.mp3", Title: "A", Elapsed: 21, Duration: 100, Volume: "50"})
+	timeout := time.After(time.Second)
+	for changed := false; !changed; {
+		select {
+		case sig := <-signals:
+			if sig.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+				continue
+			}
+			props := sig.Body[1].(map[string]dbus.Variant)
+			if _, ok := props["Position"]; ok {
+				t.Error("PropertiesChanged emitted for Position")
+			}
+			if _, ok := props["PlaybackStatus"]; ok {
+				changed = true
+			}
+			for _, name := range sig.Body[2].([]string) {
+				if name == "Position" {
+					t.Error("Position invalidated")
+				}
+			}
+		case <-timeout:
+			t.Fatal("PlaybackStatus change not signalled")
+		}
+	}
+	v, err = obj.GetProperty(mprisPlayerIface + ".Position")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := v.Value().(int64); pos != 21e6 {
+		t.Errorf("Position when paused = %d", pos)
+	}
+}
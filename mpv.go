@@ -0,0 +1,438 @@
+package main
+
+// mpv player controlled by JSON IPC (--input-ipc-server)
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mpvTimeout = 2 * time.Second
+
+var mpvObservedProperties = []string{
+	"pause", "idle-active", "volume", "media-title", "playlist-pos",
+	"playlist-count", "loop-playlist", "shuffle",
+}
+
+type mpvRequest struct {
+	Command   []interface{} `json:"command"`
+	RequestID int           `json:"request_id"`
+}
+
+type mpvResponse struct {
+	Error     string      `json:"error"`
+	Data      interface{} `json:"data"`
+	RequestID int         `json:"request_id"`
+	Event     string      `json:"event"`
+	Name      string      `json:"name"`
+}
+
+func mpvDial() (net.Conn, error) {
+	return net.DialTimeout("unix", configuration.MPVConf.Socket, mpvTimeout)
+}
+
+// mpvConn is connection to mpv shared by commands; reconnected after errors
+type mpvConn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	reqID  int
+}
+
+var mpvCmdConn mpvConn
+
+// mpvError is error returned by mpv for command
+type mpvError string
+
+func (e mpvError) Error() string { return string(e) }
+
+// mpvCommand execute one command and return its result
+func mpvCommand(args ...interface{}) (interface{}, error) {
+	return mpvCmdConn.command(args)
+}
+
+func (c *mpvConn) command(args []interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// stale connection (ie. after mpv restart) is retried once
+	for retry := c.conn != nil; ; retry = false {
+		if c.conn == nil {
+			conn, err := mpvDial()
+			if err != nil {
+				mpvLog.Error("mpvCommand connect error: ", err.Error())
+				return nil, err
+			}
+			c.conn, c.reader = conn, bufio.NewReader(conn)
+		}
+		res, err := c.exec(args)
+		if _, ok := err.(mpvError); err == nil || ok {
+			return res, err
+		}
+		c.close()
+		if !retry {
+			return nil, err
+		}
+	}
+}
+
+// exec send command and wait for its response; skip events and responses
+// to other requests
+func (c *mpvConn) exec(args []interface{}) (interface{}, error) {
+	c.reqID++
+	req, err := json.Marshal(&mpvRequest{Command: args, RequestID: c.reqID})
+	if err != nil {
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Now().Add(mpvTimeout))
+	if _, err = c.conn.Write(append(req, '\n')); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var resp mpvResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue
+		}
+		if resp.Event != "" || resp.RequestID != c.reqID {
+			continue
+		}
+		if resp.Error != "success" {
+			return nil, mpvError(resp.Error)
+		}
+		return resp.Data, nil
+	}
+}
+
+func (c *mpvConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.reader = nil, nil
+	}
+}
+
+func mpvExec(args ...interface{}) {
+	if _, err := mpvCommand(args...); err != nil {
+		mpvLog.Errorf("mpv: command %v error: %v", args, err)
+	}
+}
+
+func mpvGetProperty(name string) (interface{}, error) {
+	return mpvCommand("get_property", name)
+}
+
+func mpvGetBool(name string) (bool, error) {
+	v, err := mpvGetProperty(name)
+	if err != nil {
+		return false, err
+	}
+	b, _ := v.(bool)
+	return b, nil
+}
+
+func mpvGetFloat(name string) (float64, error) {
+	v, err := mpvGetProperty(name)
+	if err != nil {
+		return 0, err
+	}
+	f, _ := v.(float64)
+	return f, nil
+}
+
+// MPV client; implements Player
+type MPV struct {
+	messages chan *PlayerStatus
+	events   chan string
+	conn     net.Conn
+	active   bool
+}
+
+// NewMPV create new mpv client
+func NewMPV() *MPV {
+	return &MPV{
+		messages: make(chan *PlayerStatus, 5),
+		events:   make(chan string, 5),
+		active:   true,
+	}
+}
+
+func (m *MPV) watch() (err error) {
+	m.conn, err = mpvDial()
+	if err != nil {
+		mpvLog.Errorf("mpv.watch: connect to %v error: %v", configuration.MPVConf.Socket, err.Error())
+		return err
+	}
+	defer m.conn.Close()
+
+	mpvLog.Info("mpv.watch: connected to ", configuration.MPVConf.Socket)
+
+	enc := json.NewEncoder(m.conn)
+	for i, prop := range mpvObservedProperties {
+		cmd := &mpvRequest{
+			Command:   []interface{}{"observe_property", i + 1, prop},
+			RequestID: 100 + i,
+		}
+		if err = enc.Encode(cmd); err != nil {
+			return err
+		}
+	}
+
+	m.messages <- m.Status()
+
+	scanner := bufio.NewScanner(m.conn)
+	for scanner.Scan() {
+		var resp mpvResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			mpvLog.Debugf("mpv.watch: invalid message: %v", err)
+			continue
+		}
+		if resp.Event == "" {
+			continue
+		}
+		mpvLog.Debugf("mpv.watch: event: %v %v", resp.Event, resp.Name)
+		if resp.Event != "property-change" {
+			continue
+		}
+		if resp.Name == "playlist-count" {
+			m.events <- "playlist"
+		}
+		m.messages <- m.Status()
+	}
+	if err = scanner.Err(); err == nil && m.active {
+		err = io.EOF
+	}
+	return err
+}
+
+// Connect to mpv and start watching
+func (m *MPV) Connect() error {
+	go func() {
+		for m.active {
+			if err := m.watch(); err != nil && m.active {
+				mpvLog.Errorf("mpv.Connect: watch error: %v", err)
+				time.Sleep(5 * time.Second)
+			}
+		}
+		mpvLog.Infof("mpv.watch: closing")
+	}()
+	return nil
+}
+
+// Close mpv client
+func (m *MPV) Close() {
+	mpvLog.Debugln("mpv.Close")
+	m.active = false
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	mpvCmdConn.mu.Lock()
+	mpvCmdConn.close()
+	mpvCmdConn.mu.Unlock()
+}
+
+func (m *MPV) Messages() <-chan *PlayerStatus {
+	return m.messages
+}
+
+func (m *MPV) Events() <-chan string {
+	return m.events
+}
+
+// Ping check is mpv socket available
+func (m *MPV) Ping() error {
+	conn, err := mpvDial()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Status get current mpv status
+func (m *MPV) Status() (s *PlayerStatus) {
+	s = playerStatusFree.Get().(*PlayerStatus)
+	*s = PlayerStatus{Flags: "ERR"}
+
+	idle, err := mpvGetBool("idle-active")
+	if err != nil {
+		mpvLog.Errorf("mpv.Status: error: %v", err)
+		return
+	}
+	pause, _ := mpvGetBool("pause")
+
+	switch {
+	case idle:
+		s.Status = "stop"
+	case pause:
+		s.Status = "pause"
+	default:
+		s.Status = "play"
+	}
+	s.Playing = s.Status != "stop"
+
+	if vol, err := mpvGetFloat("volume"); err == nil {
+		s.Volume = strconv.Itoa(int(vol))
+	}
+
+	s.Flags = ""
+	if loop, err := mpvGetProperty("loop-playlist"); err == nil && loop != false && loop != "no" {
+		s.Flags += "R"
+	}
+	if shuffle, _ := mpvGetBool("shuffle"); shuffle {
+		s.Flags += "S"
+	}
+
+	var res []string
+	if pos, err := mpvGetFloat("playlist-pos"); err == nil && pos >= 0 {
+		count, _ := mpvGetFloat("playlist-count")
+		res = append(res, strconv.Itoa(int(pos)+1)+"/"+strconv.Itoa(int(count)))
+	}
+	if title, err := mpvGetProperty("media-title"); err == nil {
+		if t, ok := title.(string); ok && t != "" {
+			res = append(res, t)
+		}
+	}
+	s.CurrentSong = strings.Join(res, "; ")
+
+	s.Elapsed, _ = mpvGetFloat("time-pos")
+	s.Duration, _ = mpvGetFloat("duration")
+	s.Artist = mpvMetadata("artist")
+	s.Album = mpvMetadata("album")
+	s.Title = mpvMetadata("title")
+
+	if path, err := mpvGetProperty("path"); err == nil {
+		s.File, _ = path.(string)
+		if p, ok := path.(string); ok && isStream(p) {
+			s.Stream = true
+			s.StationName = stationName(p)
+			if s.StationName == "" {
+				s.StationName = mpvMetadata("icy-name")
+			}
+			if s.StationName == "" {
+				s.StationName = p
+			}
+			s.Title = streamTitle(mpvMetadata("artist"), mpvMetadata("icy-title"))
+		}
+	}
+	return
+}
+
+// mpvMetadata return metadata value for `key` of current file
+func mpvMetadata(key string) string {
+	v, err := mpvGetProperty("metadata/by-key/" + key)
+	if err != nil {
+		return ""
+	}
+	res, _ := v.(string)
+	return res
+}
+
+func (m *MPV) Play(index int) {
+	if index >= 0 {
+		mpvExec("set_property", "playlist-pos", index)
+	}
+	mpvExec("set_property", "pause", false)
+}
+
+func (m *MPV) Stop() {
+	mpvExec("stop", "keep-playlist")
+}
+
+func (m *MPV) Pause() {
+	mpvExec("cycle", "pause")
+}
+
+func (m *MPV) Next() {
+	mpvExec("playlist-next")
+}
+
+func (m *MPV) Prev() {
+	mpvExec("playlist-prev")
+}
+
+func (m *MPV) Volume() int {
+	vol, err := mpvGetFloat("volume")
+	if err != nil {
+		return -1
+	}
+	return int(vol)
+}
+
+func (m *MPV) SetVolume(vol int) {
+	mpvExec("set_property", "volume", vol)
+}
+
+func (m *MPV) ToggleRandom() {
+	mpvExec("cycle", "shuffle")
+}
+
+func (m *MPV) ToggleRepeat() {
+	mpvExec("cycle-values", "loop-playlist", "inf", "no")
+}
+
+// Queue return mpv playlist
+func (m *MPV) Queue() (items []string, pos int) {
+	data, err := mpvGetProperty("playlist")
+	if err != nil {
+		mpvLog.Error("mpv.Queue error: ", err)
+		return
+	}
+	entries, _ := data.([]interface{})
+	for i, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cur, _ := entry["current"].(bool); cur {
+			pos = i
+		}
+		if title, ok := entry["title"].(string); ok && title != "" {
+			items = append(items, title)
+		} else {
+			fname, _ := entry["filename"].(string)
+			items = append(items, fname)
+		}
+	}
+	return
+}
+
+// Playlists return playlists files found in configured directory
+func (m *MPV) Playlists() (pls []string) {
+	dir := configuration.MPVConf.PlaylistsDir
+	if dir == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		mpvLog.Error("mpv.Playlists error: ", err)
+		return
+	}
+	for _, f := range files {
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".m3u", ".m3u8", ".pls":
+			pls = append(pls, f.Name())
+		}
+	}
+	return
+}
+
+func (m *MPV) PlayURL(url string) {
+	mpvExec("loadfile", url, "replace")
+	mpvExec("set_property", "pause", false)
+}
+
+func (m *MPV) PlayPlaylist(playlist string) {
+	path := filepath.Join(configuration.MPVConf.PlaylistsDir, filepath.Base(playlist))
+	mpvExec("loadlist", path, "replace")
+	mpvExec("set_property", "pause", false)
+}
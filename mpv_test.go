@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMPV serve mpv json ipc on unix socket
+type fakeMPV struct {
+	mu       sync.Mutex
+	props    map[string]interface{}
+	watchers map[net.Conn]bool
+	conns    int
+	ln       net.Listener
+}
+
+func newFakeMPV(t *testing.T) *fakeMPV {
+	sock := filepath.Join(t.TempDir(), "mpv.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeMPV{
+		ln:       ln,
+		watchers: make(map[net.Conn]bool),
+		props: map[string]interface{}{
+			"idle-active":    false,
+			"pause":          false,
+			"volume":         40.0,
+			"loop-playlist":  "inf",
+			"shuffle":        false,
+			"playlist-pos":   1.0,
+			"playlist-count": 3.0,
+			"media-title":    "Song",
+			"path":           "/music/song.mp3",
+		},
+	}
+	configuration = &Configuration{}
+	configuration.MPVConf.Socket = sock
+	go f.serve()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeMPV) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns++
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeMPV) handle(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req mpvRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || len(req.Command) == 0 {
+			continue
+		}
+		resp := map[string]interface{}{"request_id": req.RequestID, "error": "success"}
+		f.mu.Lock()
+		switch req.Command[0] {
+		case "observe_property":
+			f.watchers[conn] = true
+		case "get_property":
+			if v, ok := f.props[req.Command[1].(string)]; ok {
+				resp["data"] = v
+			} else {
+				resp["error"] = "property unavailable"
+			}
+		}
+		// events are sent to all clients
+		enc.Encode(map[string]interface{}{"event": "audio-reconfig"})
+		enc.Encode(resp)
+		f.mu.Unlock()
+	}
+}
+
+// set change property and notify watchers
+func (f *fakeMPV) set(name string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.props[name] = value
+	for conn := range f.watchers {
+		json.NewEncoder(conn).Encode(map[string]interface{}{
+			"event": "property-change", "name": name, "data": value})
+	}
+}
+
+func (f *fakeMPV) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func TestMPVWatch(t *testing.T) {
+	f := newFakeMPV(t)
+	m := NewMPV()
+	done := make(chan error, 1)
+	go func() { done <- m.watch() }()
+
+	next := func() *PlayerStatus {
+		t.Helper()
+		select {
+		case st := <-m.Messages():
+			return st
+		case <-time.After(2 * time.Second):
+			t.Fatal("status not received")
+		}
+		return nil
+	}
+
+	st := next()
+	if st.Status != "play" || st.Volume != "40" || st.Flags != "R" ||
+		st.CurrentSong != "2/3; Song" || st.File != "/music/song.mp3" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	f.set("pause", true)
+	if st := next(); st.Status != "pause" || !st.Playing {
+		t.Errorf("unexpected status after pause: %+v", st)
+	}
+
+	f.set("playlist-count", 4.0)
+	select {
+	case ev := <-m.Events():
+		if ev != "playlist" {
+			t.Errorf("unexpected event %q", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("playlist event not received")
+	}
+	if st := next(); st.CurrentSong != "2/4; Song" {
+		t.Errorf("unexpected song after playlist change: %q", st.CurrentSong)
+	}
+
+	if vol := m.Volume(); vol != 40 {
+		t.Errorf("Volume = %d", vol)
+	}
+
+	// watch connection and one connection shared by all commands
+	if n := f.connections(); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+
+	m.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Logf("watch finished: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch not finished after Close")
+	}
+}
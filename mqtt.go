@@ -0,0 +1,240 @@
+package main
+
+// MQTT integration (status publishing, commands, Home Assistant discovery)
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttTimeout                = 5 * time.Second
+	defaultMQTTTopic           = "rpilcd"
+	defaultMQTTClientID        = "rpilcd"
+	defaultMQTTDiscoveryPrefix = "homeassistant"
+)
+
+// mqttStatus is player status published as json
+type mqttStatus struct {
+	State   string `json:"state"`
+	Volume  string `json:"volume"`
+	Flags   string `json:"flags"`
+	Song    string `json:"song"`
+	Station string `json:"station,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Server  string `json:"server,omitempty"`
+}
+
+// MQTT client publishing status and receiving commands
+type MQTT struct {
+	// Requests are commands received from mqtt; handled like control
+	// socket requests
+	Requests chan *CtlRequest
+
+	client     mqtt.Client
+	topic      string
+	lastStatus []byte
+	lastLCD    string
+	// republish is set after (re)connect to force publishing current state
+	republish int32
+}
+
+// Start connect to broker configured in [mqtt]
+func (m *MQTT) Start() {
+	conf := configuration.MQTTConf
+	m.topic = conf.Topic
+	if m.topic == "" {
+		m.topic = defaultMQTTTopic
+	}
+	clientID := conf.ClientID
+	if clientID == "" {
+		clientID = defaultMQTTClientID
+	}
+
+	logger.Infof("MQTT.Start connecting to %s...", conf.Broker)
+
+	m.Requests = make(chan *CtlRequest, 5)
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(conf.Broker).
+		SetClientID(clientID).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(m.topic+"/availability", "offline", 1, true).
+		SetOnConnectHandler(m.onConnect).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			logger.Errorf("MQTT: connection lost: %v", err)
+		})
+	m.client = mqtt.NewClient(opts)
+	m.client.Connect()
+}
+
+// onConnect subscribe command topics and publish availability and discovery
+func (m *MQTT) onConnect(c mqtt.Client) {
+	logger.Info("MQTT: connected")
+	for _, cmd := range []string{"key", "msg", "menu", "volume", "player"} {
+		cmd := cmd
+		c.Subscribe(m.topic+"/cmd/"+cmd, 1, func(c mqtt.Client, msg mqtt.Message) {
+			m.command(cmd, string(msg.Payload()))
+		})
+	}
+	c.Publish(m.topic+"/availability", 1, true, "online")
+	if configuration.MQTTConf.Discovery {
+		m.publishDiscovery()
+	}
+	atomic.StoreInt32(&m.republish, 1)
+}
+
+// checkRepublish publish again cached state after reconnect
+func (m *MQTT) checkRepublish() {
+	if atomic.SwapInt32(&m.republish, 0) == 1 {
+		m.lastLCD = ""
+		if m.lastStatus != nil {
+			m.publish("status", m.lastStatus)
+		}
+	}
+}
+
+func (m *MQTT) command(cmd, payload string) {
+	logger.Debugf("MQTT: command %s '%s'", cmd, payload)
+	req := &CtlRequest{
+		Cmd:    cmd,
+		Args:   strings.TrimSpace(payload),
+		Result: make(chan string, 1),
+	}
+	select {
+	case m.Requests <- req:
+	case <-time.After(mqttTimeout):
+		logger.Errorf("MQTT: command %s timeout", cmd)
+	}
+}
+
+func (m *MQTT) publish(topic string, payload []byte) {
+	if !m.client.IsConnected() {
+		return
+	}
+	m.client.Publish(m.topic+"/"+topic, 0, true, payload)
+}
+
+// PublishStatus publish player status when changed
+func (m *MQTT) PublishStatus(s *PlayerStatus) {
+	if m.client == nil || s == nil {
+		return
+	}
+	m.checkRepublish()
+	st := &mqttStatus{
+		State:   s.Status,
+		Volume:  s.Volume,
+		Flags:   s.Flags,
+		Song:    s.CurrentSong,
+		Station: s.StationName,
+		Title:   s.Title,
+		Server:  s.Server,
+	}
+	if s.Flags == "ERR" {
+		st.State = "error"
+	}
+	payload, err := json.Marshal(st)
+	if err != nil || string(payload) == string(m.lastStatus) {
+		return
+	}
+	m.lastStatus = payload
+	m.publish("status", payload)
+}
+
+// PublishLCD publish current display content when changed
+func (m *MQTT) PublishLCD(content string) {
+	if m.client == nil {
+		return
+	}
+	m.checkRepublish()
+	if content == m.lastLCD {
+		return
+	}
+	m.lastLCD = content
+	payload, _ := json.Marshal(map[string][]string{
+		"lines": strings.Split(content, "\n"),
+	})
+	m.publish("lcd", payload)
+}
+
+// publishDiscovery publish Home Assistant discovery configuration.
+// HA has no mqtt media player platform so player is exposed as device with
+// sensors, volume number and control buttons.
+func (m *MQTT) publishDiscovery() {
+	prefix := configuration.MQTTConf.DiscoveryPrefix
+	if prefix == "" {
+		prefix = defaultMQTTDiscoveryPrefix
+	}
+	nodeID := strings.Replace(m.topic, "/", "_", -1)
+	device := map[string]interface{}{
+		"identifiers": []string{nodeID},
+		"name":        "rpilcd",
+		"model":       "rpilcd",
+		"sw_version":  AppVersion,
+	}
+
+	entity := func(component, object string, conf map[string]interface{}) {
+		conf["unique_id"] = nodeID + "_" + object
+		conf["device"] = device
+		conf["availability_topic"] = m.topic + "/availability"
+		payload, err := json.Marshal(conf)
+		if err != nil {
+			logger.Errorf("MQTT: discovery %s error: %v", object, err)
+			return
+		}
+		m.client.Publish(prefix+"/"+component+"/"+nodeID+"/"+object+"/config", 1, true, payload)
+	}
+
+	entity("sensor", "state", map[string]interface{}{
+		"name":           "State",
+		"state_topic":    m.topic + "/status",
+		"value_template": "{{ value_json.state }}",
+		"icon":           "mdi:music",
+	})
+	entity("sensor", "song", map[string]interface{}{
+		"name":           "Song",
+		"state_topic":    m.topic + "/status",
+		"value_template": "{{ value_json.song }}",
+		"icon":           "mdi:music-note",
+	})
+	entity("number", "volume", map[string]interface{}{
+		"name":           "Volume",
+		"state_topic":    m.topic + "/status",
+		"value_template": "{{ value_json.volume }}",
+		"command_topic":  m.topic + "/cmd/volume",
+		"min":            0,
+		"max":            100,
+		"icon":           "mdi:volume-high",
+	})
+	for _, action := range []string{"play", "pause", "stop", "next", "prev"} {
+		entity("button", action, map[string]interface{}{
+			"name":          strings.ToUpper(action[:1]) + action[1:],
+			"command_topic": m.topic + "/cmd/player",
+			"payload_press": action,
+		})
+	}
+	entity("text", "message", map[string]interface{}{
+		"name":          "Display message",
+		"command_topic": m.topic + "/cmd/msg",
+		"max":           255,
+		"icon":          "mdi:message-text",
+	})
+}
+
+// Close disconnect from broker
+func (m *MQTT) Close() {
+	if m.client == nil {
+		return
+	}
+	if m.client.IsConnected() {
+		m.client.Publish(m.topic+"/availability", 1, true, "offline").WaitTimeout(mqttTimeout)
+	}
+	m.client.Disconnect(250)
+}
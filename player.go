@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Player is interface for music players controlled by rpilcd
+type Player interface {
+	// Connect start watching player; status changes are sent to Messages
+	Connect() error
+	Close()
+	// Messages return channel with status changes
+	Messages() <-chan *PlayerStatus
+	// Events return channel with other player events (i.e. "playlist")
+	Events() <-chan string
+	// Status return current player status; result should be freed
+	Status() *PlayerStatus
+	// Ping check connection to player
+	Ping() error
+
+	// Play item on `index` position in queue; -1 = current
+	Play(index int)
+	Stop()
+	// Pause toggle pause
+	Pause()
+	Next()
+	Prev()
+	// Volume return current volume (0-100); -1 on error
+	Volume() int
+	SetVolume(vol int)
+	ToggleRandom()
+	ToggleRepeat()
+
+	// Queue return items in current play queue and current position
+	Queue() (items []string, pos int)
+	// Playlists return list of stored playlists
+	Playlists() []string
+	// PlayPlaylist replace queue by `playlist` and start playing
+	PlayPlaylist(playlist string)
+	// PlayURL replace queue by stream `url` and start playing
+	PlayURL(url string)
+}
+
+// QueuePager is implemented by players that can load play queue partially
+type QueuePager interface {
+	// QueueLen return number of items in queue and current position
+	QueueLen() (items, pos int)
+	// QueueItems return labels of items in range [start, end)
+	QueueItems(start, end int) []string
+}
+
+// QueueModes is implemented by players supporting consume and single modes
+type QueueModes interface {
+	ToggleConsume()
+	ToggleSingle()
+}
+
+var player Player
+
+// NewPlayer create player configured in [player] section
+func NewPlayer() Player {
+	switch configuration.PlayerConf.Kind {
+	case "mpv":
+		logger.Info("main: using mpv player")
+		return NewMPV()
+	case "", "mpd":
+		return NewMPD()
+	}
+	logger.Errorf("NewPlayer: unknown player '%s'; using mpd", configuration.PlayerConf.Kind)
+	return NewMPD()
+}
+
+// PlayerStatus is current state of player
+type PlayerStatus struct {
+	CurrentSong string
+	Playing     bool
+	Status      string
+	Flags       string
+	Volume      string
+	Error       string
+	// Server is name of mpd server (when more than one configured)
+	Server string
+	// Updating is true when database update is in progress
+	Updating bool
+	// Stream is true when current song is network stream; then
+	// StationName and Title are filled from stream metadata
+	Stream      bool
+	StationName string
+	Title       string
+	// metadata of current song (Title is song title for files)
+	Artist   string
+	Album    string
+	File     string
+	Elapsed  float64
+	Duration float64
+}
+
+var playerStatusFree = sync.Pool{
+	New: func() interface{} { return new(PlayerStatus) },
+}
+
+func (s *PlayerStatus) Free() {
+	playerStatusFree.Put(s)
+}
+
+func (s *PlayerStatus) String() string {
+	return fmt.Sprintf("PlayerStatus[Playing=%v Status=%v Flags=%v Volume=%v CurrentSong='%v']",
+		s.Playing, s.Status, s.Flags, s.Volume, s.CurrentSong)
+}
+
+func changeVol(change int) {
+	vol := player.Volume()
+	if vol < 0 {
+		return
+	}
+	vol += change
+	if vol > 100 {
+		vol = 100
+	} else if vol < 0 {
+		vol = 0
+	}
+	player.SetVolume(vol)
+}
+
+func playerVolUp() {
+	changeVol(5)
+}
+
+func playerVolDown() {
+	changeVol(-5)
+}
+
+var preMuteVol = -1
+
+func playerVolMute() {
+	vol := player.Volume()
+	if vol < 0 {
+		return
+	}
+
+	if vol == 0 {
+		if preMuteVol > 0 {
+			player.SetVolume(preMuteVol)
+		} else {
+			player.SetVolume(100)
+		}
+	} else {
+		preMuteVol = vol
+		player.SetVolume(0)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+// Internet radio stations
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Station is one favourite radio station
+type Station struct {
+	Name string
+	URL  string `toml:"url"`
+}
+
+// isStream check is `file` a network stream
+func isStream(file string) bool {
+	return strings.Contains(file, "://")
+}
+
+// stationName find name of configured station by stream url
+func stationName(url string) string {
+	for _, st := range configuration.Stations {
+		if st.URL == url {
+			return st.Name
+		}
+	}
+	return ""
+}
+
+// streamTitle format stream metadata as "Artist - Title"
+func streamTitle(artist, title string) string {
+	if artist != "" && title != "" && !strings.Contains(title, " - ") {
+		return artist + " - " + title
+	}
+	if title != "" {
+		return title
+	}
+	return artist
+}
+
+// PlayStation start playing station with index `idx`
+func PlayStation(idx int) *Station {
+	if idx < 0 || idx >= len(configuration.Stations) {
+		return nil
+	}
+	st := configuration.Stations[idx]
+	logger.Infof("PlayStation: %s (%s)", st.Name, st.URL)
+	player.PlayURL(st.URL)
+	return st
+}
+
+// findStation return index of station with `name`
+func findStation(name string) int {
+	for i, st := range configuration.Stations {
+		if st.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxStationPresets is number of stations selectable by numeric keys
+const maxStationPresets = 9
+
+// stationPreset return index of station assigned to preset `key`
+func stationPreset(key string) int {
+	for i, k := range configuration.Keys.Radio.Presets {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewStationsScreen create screen with configured stations; select start
+// playing
+func NewStationsScreen() *ListScreen {
+	var labels []string
+	for i, st := range configuration.Stations {
+		label := st.Name
+		if i < maxStationPresets {
+			label = strconv.Itoa(i+1) + " " + label
+		}
+		labels = append(labels, label)
+	}
+	return &ListScreen{
+		Source: StringsSource(labels),
+		Empty:  "No stations",
+		OnSelect: func(idx int) (int, Screen) {
+			st := PlayStation(idx)
+			return ActionResultOk, &TextScreen{Lines: []string{st.Name}, Timeout: 2}
+		},
+	}
+}
+
+// executeRadio handle menu items of "radio" kind
+func (t *MenuItem) executeRadio() (result int, screen Screen) {
+	switch t.Cmd {
+	case "stations":
+		return ActionResultOk, NewStationsScreen()
+	case "play":
+		if len(t.Args) == 0 {
+			break
+		}
+		if st := PlayStation(findStation(t.Args[0])); st != nil {
+			return ActionResultOk, &TextScreen{Lines: []string{st.Name}, Timeout: 2}
+		}
+	}
+	return ActionResultNop, nil
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,19 +30,32 @@ type Display interface {
 	Display(string)
 	Close()
 	ToggleBacklight()
+	SetBacklight(on bool)
+	// SetCursor show blinking cursor at given position; negative col hide it
+	SetCursor(col, row int)
 	Active() bool
 }
 
 func main() {
-	//go func() {
-	//logger.Println(http.ListenAndServe(":6060", nil))
-	//}()
 	soutput := flag.Bool("console", false, "Print on console instead of lcd")
 	lcdOffOnStart := flag.Bool("off-on-start", false, "Turn off lcd on start")
-	logLevel := flag.Int("log-level", 1, "Log level (3=debug, 2=info, 1=error, 0=silent)")
+	logLevel := flag.String("log-level", "", "Log level (debug, info, error, silent or 3..0); override configuration")
 	flag.Parse()
 
-	logger.SetLogLevel(*logLevel)
+	setLogLevel := func() {
+		configureLogging(&configuration.LoggingConf)
+		if *logLevel != "" {
+			level, err := parseLogLevel(*logLevel)
+			if err != nil {
+				panic(err)
+			}
+			logger.SetLogLevel(level)
+		}
+	}
+
+	if flag.Arg(0) == "ctl" {
+		os.Exit(ctlMain(flag.Args()[1:]))
+	}
 
 	systemd.NotifyStatus("starting")
 	systemd.AutoWatchdog()
@@ -51,24 +66,63 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	setLogLevel()
 	logger.Debugf("configuration: %#v", configuration)
 
+	timers = NewTimers()
+	scheduler = NewScheduler()
+	macros = NewMacros()
+	scripts = NewScripts()
+	// player is used by mpris, mqtt and control socket handlers
+	player = NewPlayer()
+
+	// never fall back to plain text when tls is configured
+	tlsConf, err := tlsConfig()
+	if err != nil {
+		logger.Fatal("main: load tls certificate error: ", err.Error())
+	}
+	if configuration.ServicesConf.TCPTLS && tlsConf == nil {
+		logger.Fatal("main: tcp_tls require tls_cert and tls_key")
+	}
+
 	ws := UMServer{
-		Addr: configuration.ServicesConf.TCPServerAddr,
+		Addr:    configuration.ServicesConf.TCPServerAddr,
+		Token:   configuration.ServicesConf.TCPToken,
+		Allowed: parseAllowedIPs(configuration.ServicesConf.AllowedIPs),
+	}
+	if configuration.ServicesConf.TCPTLS {
+		ws.TLS = tlsConf
 	}
 	if configuration.ServicesConf.TCPServerAddr != "" {
 		ws.Start()
 	}
 
-	mpd := NewMPD()
+	ctl := CtlServer{
+		Path:  configuration.ServicesConf.ControlSocket,
+		Mode:  configuration.ServicesConf.ControlSocketMode,
+		Group: configuration.ServicesConf.ControlSocketGroup,
+	}
+	if ctl.Path != "" {
+		ctl.Start()
+	}
+
+	mq := MQTT{}
+	if configuration.MQTTConf.Broker != "" {
+		mq.Start()
+	}
+
+	mpris := MPRIS{}
+	if configuration.MPRISConf.Bus != "" {
+		mpris.Start()
+	}
+
 	scrMgr := NewScreenMgr(*soutput)
 	lirc := NewLirc()
+	alerts := NewAlerts()
+	logWatch := NewLogWatch()
 
 	if configuration.ServicesConf.HTTPServerAddr != "" {
-		http.Handle("/metrics", prometheus.Handler())
-		http.HandleFunc("/", scrMgr.WebHandler)
-		logger.Infof("webserver starting (%s)...", configuration.ServicesConf.HTTPServerAddr)
-		go http.ListenAndServe(configuration.ServicesConf.HTTPServerAddr, nil)
+		startWebServer(scrMgr, tlsConf)
 	}
 
 	defer func() {
@@ -76,19 +130,38 @@ func main() {
 			logger.Infof("Recover: %v", e)
 		}
 		systemd.Notify("STOPPING=1\r\nSTATUS=stopping")
+		logger.Info("main.defer: closing mpris")
+		mpris.Close()
+		logger.Info("main.defer: closing mqtt")
+		mq.Close()
+		logger.Info("main.defer: closing control socket")
+		ctl.Close()
+		logger.Info("main.defer: closing scripts")
+		scripts.Close()
+		logger.Info("main.defer: closing macros")
+		macros.Close()
+		logger.Info("main.defer: closing log watch")
+		logWatch.Close()
+		logger.Info("main.defer: closing alerts")
+		alerts.Close()
 		logger.Info("main.defer: closing lirc")
 		lirc.Close()
 		logger.Info("main.defer: closing disp")
 		scrMgr.Close()
-		logger.Info("main.defer: closing mpd")
-		mpd.Close()
+		logger.Info("main.defer: closing player")
+		player.Close()
 		time.Sleep(2 * time.Second)
 		logger.Info("main.defer: all closed")
 		systemd.NotifyStatus("stopped")
 	}()
 
-	mpd.Connect()
-	scrMgr.UpdateMpdStatus(MPDGetStatus())
+	player.Connect()
+	st := player.Status()
+	scrMgr.UpdatePlayerStatus(st)
+	scripts.UpdatePlayerStatus(st)
+	mq.PublishStatus(st)
+	mpris.Update(st)
+	st.Free()
 	scrMgr.display(false)
 
 	time.Sleep(1 * time.Second)
@@ -101,7 +174,7 @@ func main() {
 	signal.Notify(sig, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGTERM)
 
 	sigHup := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP)
+	signal.Notify(sigHup, syscall.SIGHUP)
 
 	if *lcdOffOnStart {
 		scrMgr.NewCommand(configuration.Keys.ToggleLCD)
@@ -116,25 +189,62 @@ func main() {
 			return
 		case _ = <-sigHup:
 			logger.Info("Reloading configuration")
-			ticker.Stop()
-			err := loadConfiguration()
-			if err != nil {
-				panic(err)
+			if err := loadConfiguration(); err != nil {
+				logger.Errorf("main: reload configuration error: %v", err)
+				continue
 			}
+			setLogLevel()
+			ticker.Stop()
 			ticker = createTicker()
+			timers = timers.Reload()
+			scheduler = NewScheduler()
+			macros.Reload()
+			alerts.Close()
+			alerts = NewAlerts()
+			logWatch.Close()
+			logWatch = NewLogWatch()
 		case ev := <-lirc.Events:
 			if ev != "" {
-				scrMgr.NewCommand(ev)
+				metricsKeyEvents.WithLabelValues("lirc", metricsKeyLabel(ev)).Inc()
+				scrMgr.RemoteKey(ev)
 			}
 		case msg := <-ws.Message:
 			if msg != "" {
+				metricsKeyEvents.WithLabelValues("tcp", metricsKeyLabel(strings.TrimSpace(msg))).Inc()
 				scrMgr.NewCommand(msg)
 			}
-		case msg := <-mpd.Message:
-			scrMgr.UpdateMpdStatus(msg)
+		case req := <-ctl.Requests:
+			req.Result <- scrMgr.Control(req)
+		case req := <-macros.Requests:
+			req.Result <- scrMgr.Control(req)
+		case req := <-mq.Requests:
+			if res := scrMgr.Control(req); strings.HasPrefix(res, "ERR") {
+				logger.Errorf("MQTT: command %s error: %s", req.Cmd, res)
+			}
+		case msg := <-alerts.Message:
+			scrMgr.AddUrgentMsg(msg)
+		case msg := <-logWatch.Message:
+			scrMgr.AddUrgentMsg(msg)
+		case msg := <-scripts.Message:
+			scrMgr.AddUrgentMsg(msg)
+		case msg := <-player.Messages():
+			scrMgr.UpdatePlayerStatus(msg)
+			scripts.UpdatePlayerStatus(msg)
+			mq.PublishStatus(msg)
+			mpris.Update(msg)
 			msg.Free()
-		case <-ticker.C:
+		case ev := <-player.Events():
+			scrMgr.MPDEvent(ev)
+		case now := <-ticker.C:
+			timers.Tick()
+			scripts.Tick(now)
+			for _, req := range scheduler.Tick(now) {
+				if res := scrMgr.Control(req); strings.HasPrefix(res, "ERR") {
+					logger.Errorf("Scheduler: command %s error: %s", req.Cmd, res)
+				}
+			}
 			scrMgr.Tick()
+			mq.PublishLCD(scrMgr.lastContent)
 		}
 	}
 }
@@ -142,3 +252,34 @@ func main() {
 func createTicker() *time.Ticker {
 	return time.NewTicker(time.Duration(configuration.DisplayConf.RefreshInterval) * time.Millisecond)
 }
+
+func startWebServer(scrMgr *ScreenMgr, tlsConf *tls.Config) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler())
+	mux.HandleFunc("/history", history.WebHandler)
+	mux.HandleFunc("/macro/", macros.WebHandler)
+	mux.HandleFunc("/", scrMgr.WebHandler)
+	if configuration.ServicesConf.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	server := &http.Server{
+		Addr:      configuration.ServicesConf.HTTPServerAddr,
+		Handler:   httpAuth(mux),
+		TLSConfig: tlsConf,
+	}
+	logger.Infof("webserver starting (%s)...", server.Addr)
+	go func() {
+		var err error
+		if tlsConf != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		logger.Error("webserver error: ", err.Error())
+	}()
+}
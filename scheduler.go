@@ -0,0 +1,345 @@
+package main
+
+// Cron-like scheduler of actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobConf define one scheduled job
+type JobConf struct {
+	Label string
+	// Cron expression: "minute hour day-of-month month day-of-week" or
+	// @hourly, @daily, @weekly, @monthly, @yearly
+	Cron string
+	// Command is control socket command executed by job, ie. "volume 30",
+	// "playlist morning", "player stop", "backlight off",
+	// "menu /mpd/mpd update", "msg Hello"
+	Command string
+	// Disabled jobs are not run until enabled in menu
+	Disabled bool
+
+	sched *cronSchedule
+}
+
+func (j *JobConf) key() string {
+	if j.Label != "" {
+		return j.Label
+	}
+	return j.Cron + " " + j.Command
+}
+
+func (j *JobConf) request() *CtlRequest {
+	fields := strings.SplitN(strings.TrimSpace(j.Command), " ", 2)
+	req := &CtlRequest{Cmd: fields[0]}
+	if len(fields) > 1 {
+		req.Args = strings.TrimSpace(fields[1])
+	}
+	return req
+}
+
+// cronSchedule is parsed cron expression; fields are bit sets of allowed values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny, dowAny are set when field is "*"
+	domAny, dowAny bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul",
+	"aug", "sep", "oct", "nov", "dec"}
+var cronDayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseCron parse 5-fields cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': expected 5 fields", expr)
+	}
+
+	s := &cronSchedule{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, err
+	}
+	// 7 is sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField parse list of values, ranges ("a-b") and steps ("*/n",
+// "a-b/n"); `names` are names of values starting from `min`
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var res uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in '%s'", field)
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = cronValue(bounds[0], min, names); err != nil {
+				return 0, err
+			}
+			to = from
+			if len(bounds) > 1 {
+				if to, err = cronValue(bounds[1], min, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("value out of range in '%s'", field)
+		}
+		for v := from; v <= to; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
+
+func cronValue(value string, min int, names []string) (int, error) {
+	lv := strings.ToLower(value)
+	for i, name := range names {
+		if name == lv {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", value)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	// like in cron, when both day fields are restricted, either may match
+	if !s.domAny && !s.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Match check is schedule active at minute of `t`
+func (s *cronSchedule) Match(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 && s.matchDay(t)
+}
+
+// Next return first matching minute after `t`; zero when not found in
+// 5 years
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) != 0 {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// schedulerState is persisted between restarts; keep only jobs changed by user
+type schedulerState struct {
+	Enabled map[string]bool `json:"enabled"`
+}
+
+// Scheduler run configured jobs
+type Scheduler struct {
+	state      schedulerState
+	lastMinute string
+}
+
+var scheduler *Scheduler
+
+// NewScheduler parse jobs and load saved state
+func NewScheduler() *Scheduler {
+	s := &Scheduler{}
+	for _, job := range configuration.SchedulerConf.Jobs {
+		sched, err := parseCron(job.Cron)
+		if err != nil {
+			logger.Errorf("Scheduler: job %s error: %v", job.key(), err)
+			continue
+		}
+		job.sched = sched
+	}
+	s.load()
+	if s.state.Enabled == nil {
+		s.state.Enabled = make(map[string]bool)
+	}
+	return s
+}
+
+func (s *Scheduler) load() {
+	fname := configuration.SchedulerConf.StateFile
+	if fname == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Scheduler.load error: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		logger.Errorf("Scheduler.load unmarshal error: %v", err)
+	}
+}
+
+func (s *Scheduler) save() {
+	fname := configuration.SchedulerConf.StateFile
+	if fname == "" {
+		return
+	}
+	data, err := json.Marshal(&s.state)
+	if err != nil {
+		logger.Errorf("Scheduler.save marshal error: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		logger.Errorf("Scheduler.save error: %v", err)
+	}
+}
+
+// Enabled check is job enabled
+func (s *Scheduler) Enabled(j *JobConf) bool {
+	if enabled, ok := s.state.Enabled[j.key()]; ok {
+		return enabled
+	}
+	return !j.Disabled
+}
+
+// Toggle enable/disable job
+func (s *Scheduler) Toggle(j *JobConf) {
+	enabled := !s.Enabled(j)
+	if enabled == !j.Disabled {
+		delete(s.state.Enabled, j.key())
+	} else {
+		s.state.Enabled[j.key()] = enabled
+	}
+	logger.Infof("Scheduler: job %s enabled: %v", j.key(), enabled)
+	s.save()
+}
+
+// Tick return requests of jobs scheduled on current minute; each minute is
+// checked once
+func (s *Scheduler) Tick(now time.Time) (reqs []*CtlRequest) {
+	minute := now.Format("2006-01-02 15:04")
+	if minute == s.lastMinute {
+		return nil
+	}
+	s.lastMinute = minute
+	for _, job := range configuration.SchedulerConf.Jobs {
+		if job.sched == nil || !s.Enabled(job) || !job.sched.Match(now) {
+			continue
+		}
+		logger.Infof("Scheduler: running job %s: %s", job.key(), job.Command)
+		reqs = append(reqs, job.request())
+	}
+	return
+}
+
+// jobsMenu create list of scheduled jobs ordered as in configuration; select
+// toggle job
+func jobsMenu() Screen {
+	jobs := configuration.SchedulerConf.Jobs
+	l := &ListScreen{Empty: "No jobs"}
+	l.Reload = func() {
+		now := time.Now()
+		var labels []string
+		for _, j := range jobs {
+			labels = append(labels, jobLabel(j, now))
+		}
+		l.Source = StringsSource(labels)
+	}
+	l.OnSelect = func(idx int) (int, Screen) {
+		scheduler.Toggle(jobs[idx])
+		l.Reload()
+		return ActionResultOk, nil
+	}
+	l.Reload()
+	return l
+}
+
+// jobLabel show next run time, state and label of job
+func jobLabel(j *JobConf, now time.Time) string {
+	next := "--:--"
+	if j.sched != nil {
+		if t := j.sched.Next(now); !t.IsZero() {
+			if t.Sub(now) < 24*time.Hour {
+				next = t.Format("15:04")
+			} else {
+				next = t.Format("Mon15:04")
+			}
+		}
+	}
+	state := "off"
+	if scheduler.Enabled(j) {
+		state = "on"
+	}
+	label := j.Label
+	if label == "" {
+		label = j.Command
+	}
+	return next + " " + state + " " + label
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -16,6 +17,8 @@ const (
 	ActionResultBack
 	ActionResultExit
 	ActionResultNop
+	// ActionResultReplace close current screen and open returned (if any)
+	ActionResultReplace
 )
 
 const (
@@ -36,6 +39,24 @@ type Screen interface {
 	Valid() bool
 }
 
+// MPDEventListener is implemented by screens that display mpd data and
+// should be refreshed on mpd subsystem change
+type MPDEventListener interface {
+	MPDEvent(subsystem string)
+}
+
+// NumberSelector is implemented by screens that allow select item by
+// number entered with numeric keys; confirmed is false when input timed out
+type NumberSelector interface {
+	SelectNumber(num int, confirmed bool) (result int, screen Screen)
+}
+
+// PresetSelector is implemented by screens that play preset `num` entered
+// with numeric keys and confirmed by stations key
+type PresetSelector interface {
+	SelectPreset(num int) (result int, screen Screen)
+}
+
 type TextScreen struct {
 	Lines  []string
 	offset int
@@ -93,50 +114,88 @@ type MenuItem struct {
 	Kind            string
 	Items           []*MenuItem
 	RunInBackground bool
-	offset          int
-	cursor          int
-}
-
-func (t *MenuItem) Show() (res []string, fixPart int) {
-	for i := t.offset; i < len(t.Items) && i < (t.offset+lcdHeight); i++ {
-		if i == t.cursor {
-			res = append(res, CharCursor+t.Items[i].Label)
-		} else {
-			res = append(res, " "+t.Items[i].Label)
+	// Prompt, when set, ask for text before execute item; "{input}" in
+	// Args is replaced by entered text
+	Prompt string
+	// Min, Max and Step define range of "value" item
+	Min, Max, Step int
+	// Get and Set are commands used to read and change "value" or "toggle"
+	// item; "{value}" in Set is replaced by new value
+	Get, Set []string
+
+	list      *ListScreen
+	state     bool
+	stateRead bool
+}
+
+func (t *MenuItem) listScreen() *ListScreen {
+	if t.list == nil {
+		t.list = &ListScreen{
+			Source:   t,
+			OnSelect: t.selectItem,
 		}
 	}
-	for len(res) < lcdHeight {
-		res = append(res, "")
+	return t.list
+}
+
+// Len return number of menu items; MenuItem is ListSource for own list
+func (t *MenuItem) Len() int {
+	return len(t.Items)
+}
+
+func (t *MenuItem) Labels(start, end int) (labels []string) {
+	for _, item := range t.Items[start:end] {
+		labels = append(labels, item.displayLabel())
 	}
-	fixPart = 1
 	return
 }
 
+func (t *MenuItem) Show() (res []string, fixPart int) {
+	return t.listScreen().Show()
+}
+
 func (t *MenuItem) Action(action string) (result int, screen Screen) {
-	switch action {
-	case configuration.Keys.Menu.Up:
-		t.cursor, t.offset = cursorScrollUp(t.cursor, t.offset, len(t.Items), 1)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Up10:
-		t.cursor, t.offset = cursorScrollUp(t.cursor, t.offset, len(t.Items), 10)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down:
-		t.cursor, t.offset = cursorScrollDown(t.cursor, t.offset, len(t.Items), 1)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down10:
-		t.cursor, t.offset = cursorScrollDown(t.cursor, t.offset, len(t.Items), 10)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Select:
-		item := t.Items[t.cursor]
-		if len(item.Items) > 0 {
-			// submenu
-			return ActionResultOk, t.Items[t.cursor]
-		}
-		return item.execute()
-	case configuration.Keys.Menu.Back:
-		return ActionResultBack, nil
+	return t.listScreen().Action(action)
+}
+
+func (t *MenuItem) selectItem(idx int) (result int, screen Screen) {
+	item := t.Items[idx]
+	if len(item.Items) > 0 {
+		// submenu
+		item.refreshToggles()
+		return ActionResultOk, item
 	}
-	return
+	if item.Prompt != "" {
+		return ActionResultOk, NewTextInputScreen(item.Prompt, "", item.executeInput)
+	}
+	return item.execute()
+}
+
+// executeInput execute item with entered text
+func (t *MenuItem) executeInput(value string) (result int, screen Screen) {
+	item := *t
+	item.Args = nil
+	for _, arg := range t.Args {
+		item.Args = append(item.Args, strings.Replace(arg, "{input}", value, -1))
+	}
+	return item.execute()
+}
+
+// SelectNumber move cursor to item `num`
+func (t *MenuItem) SelectNumber(num int, confirmed bool) (result int, screen Screen) {
+	return t.listScreen().SelectNumber(num, confirmed)
+}
+
+func (t *MenuItem) ItemLabels() []string {
+	return t.listScreen().ItemLabels()
+}
+
+func (t *MenuItem) Cursor() int {
+	return t.listScreen().Cursor()
+}
+
+func (t *MenuItem) SetCursor(idx int) {
+	t.listScreen().SetCursor(idx)
 }
 
 func (t *MenuItem) executeInBackground() string {
@@ -150,7 +209,7 @@ func (t *MenuItem) executeInBackground() string {
 
 	process, err := os.StartProcess(t.Cmd, args, attr)
 	if err != nil {
-		logger.Errorf("Start process error: err=%v", err)
+		screenLog.Errorf("Start process error: err=%v", err)
 		return err.Error()
 	}
 
@@ -159,10 +218,23 @@ func (t *MenuItem) executeInBackground() string {
 		return "<started>"
 	}
 
-	logger.Errorf("Start process release error: err=%v", err)
+	screenLog.Errorf("Start process release error: err=%v", err)
 	return err.Error()
 }
 
+// exitCode return exit code of command finished with `err`
+func exitCode(err error) string {
+	if err == nil {
+		return "0"
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok {
+			return strconv.Itoa(ws.ExitStatus())
+		}
+	}
+	return "error"
+}
+
 func (t *MenuItem) execute() (result int, screen Screen) {
 	switch t.Kind {
 	case "cmd":
@@ -172,8 +244,11 @@ func (t *MenuItem) execute() (result int, screen Screen) {
 			lines := strings.Split(res, "\n")
 			return ActionResultOk, &TextScreen{Lines: lines}
 		}
+		start := time.Now()
 		out, err := exec.Command(t.Cmd, t.Args...).CombinedOutput()
-		logger.Infof("Execute: err=%v, res=%v", err, res)
+		screenLog.Infof("Execute: err=%v, res=%v", err, res)
+		metricsCommandsDuration.WithLabelValues(t.Label).Observe(time.Since(start).Seconds())
+		metricsCommands.WithLabelValues(t.Label, exitCode(err)).Inc()
 		res = strings.TrimSpace(string(out))
 		if res == "" {
 			res = "<no output>"
@@ -182,12 +257,34 @@ func (t *MenuItem) execute() (result int, screen Screen) {
 		return ActionResultOk, &TextScreen{Lines: lines}
 
 	case "mpd":
-		switch t.Cmd {
-		case "playlists":
-			return ActionResultOk, NewMPDPlaylistsScreen()
-		case "playlist":
-			return ActionResultOk, NewMPDCurrPlaylistScreen()
+		return t.executeMPD()
+
+	case "sys":
+		return ActionResultOk, NewSysInfoScreen(t.Cmd)
+
+	case "timer":
+		return t.executeTimer()
+
+	case "radio":
+		return t.executeRadio()
+
+	case "value":
+		return ActionResultOk, NewValueScreen(t)
+
+	case "toggle":
+		return t.toggle()
+
+	case "script":
+		if t.Cmd == "" {
+			return ActionResultOk, scriptsMenu()
 		}
+		return ActionResultOk, NewScriptScreen(t.Cmd)
+
+	case "macro":
+		if err := macros.Run(t.Cmd); err != nil {
+			return ActionResultOk, &TextScreen{Lines: []string{"Error", err.Error()}, Timeout: 2}
+		}
+		return ActionResultOk, nil
 	}
 	return ActionResultNop, nil
 }
@@ -197,16 +294,23 @@ func (t *MenuItem) Valid() bool {
 }
 
 type StatusScreen struct {
-	mpdPlaying bool
-	last       []string
+	playing  bool
+	updating bool
+	last     []string
 }
 
 func (s *StatusScreen) Show() (res []string, fixPart int) {
-	if !s.mpdPlaying || len(s.last) == 0 {
+	if !s.playing || len(s.last) == 0 {
 		n := time.Now()
 		res = append(res, loadAvg()+" "+mpdStatusToStr("stop"), n.Format("01-02 15:04:05"))
 	} else {
-		res = s.last[:]
+		res = append(res, s.last...)
+	}
+	if tm := timers.Status(s.playing); tm != "" {
+		res[0] += " " + tm
+	}
+	if s.updating {
+		res[0] += " upd"
 	}
 	return
 }
@@ -221,33 +325,69 @@ var (
 )
 
 func (s *StatusScreen) Action(action string) (result int, screen Screen) {
+	if idx := stationPreset(action); idx >= 0 {
+		if st := PlayStation(idx); st != nil {
+			return ActionResultOk, &TextScreen{Lines: []string{st.Name, ""}, Timeout: 2}
+		}
+		return ActionResultOk, nil
+	}
+
 	switch action {
 	case configuration.Keys.MPD.Play:
-		MPDPlay(-1)
+		player.Play(-1)
 		return ActionResultOk, &TextScreen{Lines: linesPlay, Timeout: 2}
 	case configuration.Keys.MPD.Stop:
-		MPDStop()
+		player.Stop()
 		return ActionResultOk, &TextScreen{Lines: linesStop, Timeout: 2}
 	case configuration.Keys.MPD.Pause:
-		MPDPause()
+		player.Pause()
 		return ActionResultOk, &TextScreen{Lines: linesPause, Timeout: 2}
 	case configuration.Keys.MPD.Next:
-		MPDNext()
+		player.Next()
 		return ActionResultOk, &TextScreen{Lines: linesNext, Timeout: 2}
 	case configuration.Keys.MPD.Prev:
-		MPDPrev()
+		player.Prev()
 		return ActionResultOk, &TextScreen{Lines: linesPrev, Timeout: 2}
 	case configuration.Keys.MPD.VolUp:
-		MPDVolUp()
+		playerVolUp()
 	case configuration.Keys.MPD.VolDown:
-		MPDVolDown()
+		playerVolDown()
 	case configuration.Keys.MPD.VolMute:
-		MPDVolMute()
+		playerVolMute()
 		return ActionResultOk, &TextScreen{Lines: linesMute, Timeout: 2}
 	case configuration.Keys.MPD.Random:
-		MPDRandom()
+		player.ToggleRandom()
 	case configuration.Keys.MPD.Repeat:
-		MPDRepeat()
+		player.ToggleRepeat()
+	case configuration.Keys.MPD.Consume:
+		playerToggleConsume()
+	case configuration.Keys.MPD.Single:
+		playerToggleSingle()
+	case configuration.Keys.Radio.Stations:
+		return ActionResultOk, NewStationsScreen()
+	case configuration.Keys.MPD.Sleep:
+		minutes := timers.CycleSleep()
+		return ActionResultOk, &TextScreen{Lines: []string{sleepLabel(minutes), ""}, Timeout: 2}
+	}
+	return ActionResultOk, nil
+}
+
+// SelectNumber play song `num` from queue; not confirmed number is dropped
+func (s *StatusScreen) SelectNumber(num int, confirmed bool) (result int, screen Screen) {
+	if num < 1 || !confirmed {
+		return ActionResultOk, nil
+	}
+	player.Play(num - 1)
+	return ActionResultOk, &TextScreen{Lines: []string{"play " + strconv.Itoa(num), ""}, Timeout: 2}
+}
+
+// SelectPreset play favourite station `num` (1-9)
+func (s *StatusScreen) SelectPreset(num int) (result int, screen Screen) {
+	if num < 1 || num > maxStationPresets {
+		return ActionResultOk, nil
+	}
+	if st := PlayStation(num - 1); st != nil {
+		return ActionResultOk, &TextScreen{Lines: []string{st.Name, ""}, Timeout: 2}
 	}
 	return ActionResultOk, nil
 }
@@ -256,18 +396,19 @@ func (s *StatusScreen) Valid() bool {
 	return true
 }
 
-func (s *StatusScreen) MpdUpdate(st *MPDStatus) {
+func (s *StatusScreen) Update(st *PlayerStatus) {
 
 	if st == nil {
 		n := time.Now()
-		s.mpdPlaying = false
+		s.playing = false
 		s.last = []string{
 			loadAvg() + " " + mpdStatusToStr(st.Status),
 			n.Format("01-02 15:04:05"),
 		}
 		return
 	}
-	s.mpdPlaying = st.Playing
+	s.playing = st.Playing
+	s.updating = st.Updating
 
 	if st.Error != "" && !st.Playing {
 		s.last = []string{
@@ -277,10 +418,22 @@ func (s *StatusScreen) MpdUpdate(st *MPDStatus) {
 		return
 	}
 
+	if st.Status != "stop" && st.Stream {
+		s.last = []string{
+			mpdStatusToStr(st.Status) + " " + removeNlChars(st.StationName),
+			removeNlChars(st.Title),
+		}
+		return
+	}
+
 	if st.Status != "stop" {
+		song := st.CurrentSong
+		if st.Server != "" {
+			song = st.Server + ": " + song
+		}
 		s.last = []string{
 			loadAvg() + " " + mpdStatusToStr(st.Status) + " " + st.Flags + " " + st.Volume,
-			removeNlChars(st.CurrentSong),
+			removeNlChars(song),
 		}
 	}
 	return
@@ -294,7 +447,7 @@ func loadAvg() string {
 			return string(data[:i+2])
 		}
 	}
-	logger.Errorf("main.loadavg error: %v, %v", err, data)
+	screenLog.Errorf("main.loadavg error: %v, %v", err, data)
 	return ""
 }
 
@@ -316,7 +469,7 @@ func (u *UrgentMsgScreen) AddMsg(msg []string) {
 	defer u.mu.Unlock()
 
 	u.messages = append(u.messages, msg)
-	logger.Debugf("AddMsg: %#v", u.messages)
+	screenLog.Debugf("AddMsg: %#v", u.messages)
 }
 
 func (u *UrgentMsgScreen) Show() (res []string, fixPart int) {
@@ -368,139 +521,60 @@ func (u *UrgentMsgScreen) Valid() bool {
 	return true
 }
 
-type MPDPlaylistsScreen struct {
-	offset    int
-	cursor    int
-	playlists []string
-}
-
-func NewMPDPlaylistsScreen() *MPDPlaylistsScreen {
-	return &MPDPlaylistsScreen{
-		playlists: MPDPlaylists(),
-	}
-}
-
-func (m *MPDPlaylistsScreen) Show() (res []string, fixPart int) {
-	if len(m.playlists) == 0 {
-		res = append(res, "No playlists")
-	} else {
-		for i := m.offset; i < len(m.playlists) && i < (m.offset+lcdHeight); i++ {
-			if i == m.cursor {
-				res = append(res, CharCursor+m.playlists[i])
-			} else {
-				res = append(res, " "+m.playlists[i])
-			}
-		}
-		fixPart = 1
-	}
-	for len(res) < lcdHeight {
-		res = append(res, "")
+// NewMPDPlaylistsScreen create screen with stored playlists; select play
+// playlist
+func NewMPDPlaylistsScreen() *ListScreen {
+	l := &ListScreen{
+		Source:   StringsSource(player.Playlists()),
+		Empty:    "No playlists",
+		ReloadOn: "stored_playlist",
 	}
-	return
-}
-
-func (m *MPDPlaylistsScreen) Valid() bool {
-	return true
-}
-
-func (m *MPDPlaylistsScreen) Action(action string) (result int, screen Screen) {
-	switch action {
-	case configuration.Keys.Menu.Up:
-		m.cursor, m.offset = cursorScrollUp(m.cursor, m.offset, len(m.playlists), 1)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Up10:
-		m.cursor, m.offset = cursorScrollUp(m.cursor, m.offset, len(m.playlists), 10)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down:
-		m.cursor, m.offset = cursorScrollDown(m.cursor, m.offset, len(m.playlists), 1)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down10:
-		m.cursor, m.offset = cursorScrollDown(m.cursor, m.offset, len(m.playlists), 10)
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Select:
-		playlist := m.playlists[m.cursor]
-		MPDPlayPlaylist(playlist)
+	l.OnSelect = func(idx int) (int, Screen) {
+		player.PlayPlaylist(l.Source.Labels(idx, idx+1)[0])
 		return ActionResultOk, nil
-	case configuration.Keys.Menu.Back:
-		return ActionResultBack, nil
-	}
-	return
-}
-
-type MPDCurrPlaylistScreen struct {
-	offset int
-	cursor int
-	songs  []string
-}
-
-func NewMPDCurrPlaylistScreen() *MPDCurrPlaylistScreen {
-	pls, pos := MPDCurrPlaylist()
-	return &MPDCurrPlaylistScreen{
-		songs:  pls,
-		cursor: pos,
-		offset: pos,
-	}
-}
-
-func (m *MPDCurrPlaylistScreen) Show() (res []string, fixPart int) {
-	if len(m.songs) == 0 {
-		res = append(res, "No playlists")
-	} else {
-		fixPart = 0
-		for i := m.offset; i < len(m.songs) && i < (m.offset+lcdHeight); i++ {
-			idx := strconv.Itoa(i+1) + ". "
-			if len(idx) > fixPart {
-				fixPart = len(idx)
-			}
-			if i == m.cursor {
-				res = append(res, CharCursor+idx+m.songs[i])
-			} else {
-				res = append(res, " "+idx+m.songs[i])
-			}
-		}
-		fixPart++
 	}
-	for len(res) < lcdHeight {
-		res = append(res, "")
+	l.Reload = func() {
+		l.Source = StringsSource(player.Playlists())
 	}
-	return
+	return l
 }
 
-func (m *MPDCurrPlaylistScreen) Action(action string) (result int, screen Screen) {
-	switch action {
-	case configuration.Keys.Menu.Up:
-		if len(m.songs) > 0 {
-			m.cursor, m.offset = cursorScrollUp(m.cursor, m.offset, len(m.songs), 1)
-		}
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Up10:
-		if len(m.songs) > 0 {
-			m.cursor, m.offset = cursorScrollUp(m.cursor, m.offset, len(m.songs), 10)
-		}
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down:
-		if len(m.songs) > 0 {
-			m.cursor, m.offset = cursorScrollDown(m.cursor, m.offset, len(m.songs), 1)
-		}
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Down10:
-		if len(m.songs) > 0 {
-			m.cursor, m.offset = cursorScrollDown(m.cursor, m.offset, len(m.songs), 10)
+// NewMPDCurrPlaylistScreen create screen with current play queue; select
+// play song
+func NewMPDCurrPlaylistScreen() *ListScreen {
+	l := &ListScreen{
+		ShowIndex: true,
+		Empty:     "No songs",
+		OnSelect: func(idx int) (int, Screen) {
+			player.Play(idx)
+			return ActionResultOk, nil
+		},
+		ReloadOn: "playlist",
+	}
+
+	var pos int
+	if qp, ok := player.(QueuePager); ok {
+		src := &PagedSource{
+			Total: func() int {
+				n, _ := qp.QueueLen()
+				return n
+			},
+			Fetch: qp.QueueItems,
 		}
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Select:
-		if len(m.songs) > 0 {
-			MPDPlay(m.cursor)
+		_, pos = qp.QueueLen()
+		l.Source = src
+		l.Reload = src.Invalidate
+	} else {
+		var items []string
+		items, pos = player.Queue()
+		l.Source = StringsSource(items)
+		l.Reload = func() {
+			items, _ := player.Queue()
+			l.Source = StringsSource(items)
 		}
-		return ActionResultOk, nil
-	case configuration.Keys.Menu.Back:
-		return ActionResultBack, nil
 	}
-	return
-}
-
-func (m *MPDCurrPlaylistScreen) Valid() bool {
-	return true
+	l.SetCursor(pos)
+	return l
 }
 
 func cursorScrollUp(cursor, offset, items, step int) (rcursor, roffset int) {
@@ -544,6 +618,35 @@ func cursorScrollDown(cursor, offset, items, step int) (rcursor, roffset int) {
 	return cursor, offset
 }
 
+// cursorJump move cursor to item `idx`; ignore invalid index
+func cursorJump(cursor, offset, items, idx int) (rcursor, roffset int) {
+	if idx < 0 || idx >= items {
+		return cursor, offset
+	}
+	offset = idx
+	if offset > items-lcdHeight {
+		offset = items - lcdHeight
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return idx, offset
+}
+
+// fixCursor keep cursor and offset in range after change number of items
+func fixCursor(cursor, offset, items int) (rcursor, roffset int) {
+	if cursor >= items {
+		cursor = items - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+	if offset > cursor {
+		offset = cursor
+	}
+	return cursor, offset
+}
+
 func mpdStatusToStr(status string) string {
 	switch status {
 	case "play":
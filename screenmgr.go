@@ -1,13 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const minCmdsInterval = time.Duration(500) * time.Millisecond
 
+const (
+	defaultDigitsTimeout = 2
+	maxNumInputLen       = 4
+	// defaultNightIdleTimeout turn off display turned on in night when
+	// idle_timeout is not set
+	defaultNightIdleTimeout = time.Minute
+)
+
+var defaultDigitKeys = []string{"KEY_0", "KEY_1", "KEY_2", "KEY_3", "KEY_4",
+	"KEY_5", "KEY_6", "KEY_7", "KEY_8", "KEY_9"}
+
 type ScreenMgr struct {
 	ums         UrgentMsgScreen
 	ts          TextScroller
@@ -16,22 +29,36 @@ type ScreenMgr struct {
 	screens     []Screen
 	lastCmdTime time.Time
 	lastContent string
+
+	// lastActivity is time of last key press or mpd start
+	lastActivity time.Time
+	// idleOff is true when backlight was turned off by inactivity
+	idleOff bool
+	playing bool
+	// night is true when night mode started and backlight was turned off
+	night bool
+
+	// numInput is number entered by numeric keys
+	numInput    string
+	numDeadline time.Time
 }
 
 func NewScreenMgr(console bool) *ScreenMgr {
-	d := &ScreenMgr{}
+	d := &ScreenMgr{
+		lastActivity: time.Now(),
+	}
 
 	if !console && (configuration.DisplayConf.Display == "i2c" ||
 		configuration.DisplayConf.Display == "gpio") {
-		logger.Info("main: starting lcd")
+		screenLog.Info("main: starting lcd")
 		if lcd := NewLcd(); lcd != nil {
 			d.disp = lcd
 		} else {
-			logger.Info("main: fail back to console")
+			screenLog.Info("main: fail back to console")
 			d.disp = NewConsole()
 		}
 	} else {
-		logger.Info("main: starting console")
+		screenLog.Info("main: starting console")
 		d.disp = NewConsole()
 	}
 
@@ -48,17 +75,56 @@ func (d *ScreenMgr) Close() {
 	d.disp.Close()
 }
 
-func (d *ScreenMgr) NewCommand(msg string) {
+// RemoteKey handle key pressed on remote. When display is turned off by
+// inactivity first key only turn it on; in night mode keys other than
+// toggle_lcd are ignored.
+func (d *ScreenMgr) RemoteKey(key string) {
+	key = strings.TrimSpace(key)
+	if !d.idleOff || key == configuration.Keys.ToggleLCD {
+		d.NewCommand(key)
+		return
+	}
+	if isNightTime(time.Now()) {
+		screenLog.Debugf("ScreenMgr.RemoteKey: night mode; ignoring key %s", key)
+		return
+	}
 	if time.Now().Sub(d.lastCmdTime) < minCmdsInterval {
 		return
 	}
+	d.lastCmdTime = time.Now()
+	if d.wake(true) {
+		d.display(false)
+	}
+}
+
+func (d *ScreenMgr) NewCommand(msg string) {
+	msg = strings.TrimSpace(msg)
+	if time.Now().Sub(d.lastCmdTime) < minCmdsInterval && !d.multiTapKey(msg) {
+		return
+	}
 
 	defer func() {
 		d.lastCmdTime = time.Now()
 	}()
 
-	msg = strings.TrimSpace(msg)
-	logger.Infof("NewCommand '%s'", msg)
+	screenLog.With("KEY", msg).Infof("NewCommand '%s'", msg)
+
+	// keys from control socket, macros and scheduler are always executed;
+	// display is turned on like by playback start
+	if msg != configuration.Keys.ToggleLCD {
+		d.wake(false)
+	}
+
+	if mc := macros.ForKey(msg); mc != nil || strings.HasPrefix(msg, "macro:") {
+		name := strings.TrimPrefix(msg, "macro:")
+		if mc != nil {
+			name = mc.Name
+		}
+		if err := macros.Run(name); err != nil {
+			screenLog.Errorf("NewCommand: %v", err)
+		}
+		return
+	}
 
 	// globla commands
 	switch msg {
@@ -72,6 +138,8 @@ func (d *ScreenMgr) NewCommand(msg string) {
 		d.display(false)
 		return
 	case configuration.Keys.ToggleLCD:
+		d.idleOff = false
+		d.lastActivity = time.Now()
 		d.disp.ToggleBacklight()
 		if !d.disp.Active() {
 			d.screens = nil
@@ -81,8 +149,31 @@ func (d *ScreenMgr) NewCommand(msg string) {
 	}
 
 	screen := d.currentScreen()
-	logger.Debugf("current screen: %#v", screen)
+	screenLog.With("KEY", msg, "SCREEN", fmt.Sprintf("%T", screen)).Debugf("current screen: %#v", screen)
+
+	if sel, ok := screen.(NumberSelector); ok && d.numberInput(sel, msg) {
+		return
+	}
+
+	if sc, ok := screen.(Searchable); ok && msg != "" {
+		switch msg {
+		case configuration.Keys.Menu.NextLetter:
+			sc.SetCursor(nextLetterIndex(sc.ItemLabels(), sc.Cursor()))
+			d.display(false)
+			return
+		case configuration.Keys.Menu.Filter:
+			d.screens = append(d.screens, NewFilterScreen(sc))
+			d.display(false)
+			return
+		}
+	}
+
 	res, nextScreen := screen.Action(msg)
+	d.handleResult(res, nextScreen, msg)
+}
+
+// handleResult change screens according to screen action result
+func (d *ScreenMgr) handleResult(res int, nextScreen Screen, msg string) {
 	switch res {
 	case ActionResultBack:
 		if len(d.screens) > 0 {
@@ -92,6 +183,14 @@ func (d *ScreenMgr) NewCommand(msg string) {
 	case ActionResultExit:
 		d.screens = nil
 		d.display(false)
+	case ActionResultReplace:
+		if len(d.screens) > 0 {
+			d.screens = d.screens[:len(d.screens)-1]
+		}
+		if nextScreen != nil {
+			d.screens = append(d.screens, nextScreen)
+		}
+		d.display(false)
 	case ActionResultOk:
 		if nextScreen != nil {
 			d.screens = append(d.screens, nextScreen)
@@ -102,6 +201,82 @@ func (d *ScreenMgr) NewCommand(msg string) {
 	}
 }
 
+// numberInput handle numeric keys and confirm/cancel of entered number;
+// return true when key was consumed
+func (d *ScreenMgr) numberInput(sel NumberSelector, msg string) bool {
+	if digit := digitKey(msg); digit >= 0 {
+		if len(d.numInput) < maxNumInputLen {
+			d.numInput += strconv.Itoa(digit)
+		}
+		timeout := configuration.Keys.DigitsTimeout
+		if timeout <= 0 {
+			timeout = defaultDigitsTimeout
+		}
+		d.numDeadline = time.Now().Add(time.Duration(timeout) * time.Second)
+		d.display(false)
+		return true
+	}
+
+	if d.numInput == "" {
+		return false
+	}
+
+	switch msg {
+	case configuration.Keys.Menu.Select:
+		d.selectNumber(sel, true)
+		return true
+	case configuration.Keys.Menu.Back:
+		d.numInput = ""
+		d.display(false)
+		return true
+	case configuration.Keys.Radio.Stations:
+		if ps, ok := sel.(PresetSelector); ok {
+			num, _ := strconv.Atoi(d.numInput)
+			d.numInput = ""
+			res, nextScreen := ps.SelectPreset(num)
+			d.handleResult(res, nextScreen, "")
+			return true
+		}
+	}
+	return false
+}
+
+// selectNumber pass entered number to screen
+func (d *ScreenMgr) selectNumber(sel NumberSelector, confirmed bool) {
+	num, _ := strconv.Atoi(d.numInput)
+	d.numInput = ""
+	screenLog.Debugf("ScreenMgr.selectNumber: %d %v", num, confirmed)
+	res, nextScreen := sel.SelectNumber(num, confirmed)
+	d.handleResult(res, nextScreen, "")
+}
+
+// multiTapKey check is `key` digit pressed on screen entering text by
+// multi-tap; such keys are not rate limited
+func (d *ScreenMgr) multiTapKey(key string) bool {
+	if digitKey(key) < 0 {
+		return false
+	}
+	switch d.currentScreen().(type) {
+	case *FilterScreen, *TextInputScreen:
+		return true
+	}
+	return false
+}
+
+// digitKey return digit assigned to `key` or -1
+func digitKey(key string) int {
+	keys := configuration.Keys.Digits
+	if len(keys) == 0 {
+		keys = defaultDigitKeys
+	}
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
 func (d *ScreenMgr) currentScreen() Screen {
 	if d.ums.HasMessages() {
 		return &d.ums
@@ -122,6 +297,10 @@ func (d *ScreenMgr) display(tick bool) {
 		screen = d.currentScreen()
 	}
 	lines, fixPart := screen.Show()
+	if d.numInput != "" {
+		lines = append([]string(nil), lines...)
+		lines[len(lines)-1] = "#" + d.numInput + "_"
+	}
 	text := strings.Join(lines, "\n")
 	d.lastContent = text
 	d.ts.Set(text, fixPart)
@@ -130,21 +309,145 @@ func (d *ScreenMgr) display(tick bool) {
 	} else {
 		d.disp.Display(d.ts.Get())
 	}
+	if cs, ok := screen.(CursorScreen); ok && d.numInput == "" {
+		d.disp.SetCursor(cs.CursorPos())
+	} else {
+		d.disp.SetCursor(-1, -1)
+	}
 }
 
-func (d *ScreenMgr) UpdateMpdStatus(status *MPDStatus) {
-	d.statusScr.MpdUpdate(status)
+func (d *ScreenMgr) UpdatePlayerStatus(status *PlayerStatus) {
+	d.statusScr.Update(status)
+	updatePlayerMetrics(status)
+
+	playing := status != nil && status.Status == "play"
+	if playing && !d.playing {
+		if d.wake(false) {
+			d.display(false)
+		}
+	}
+	d.playing = playing
+}
+
+// MPDEvent pass mpd subsystem change to opened screens
+func (d *ScreenMgr) MPDEvent(subsystem string) {
+	if subsystem == "update_done" {
+		d.AddUrgentMsg("MPD database\nupdated")
+		return
+	}
+	for _, s := range d.screens {
+		if l, ok := s.(MPDEventListener); ok {
+			l.MPDEvent(subsystem)
+		}
+	}
+	d.display(false)
 }
 
 func (d *ScreenMgr) AddUrgentMsg(msg string) {
+	metricsUrgentMsgs.Inc()
 	d.ums.AddMsg(strings.Split(msg, "\n"))
+	d.wake(true)
 }
 
 func (d *ScreenMgr) Tick() {
+	if d.numInput != "" && time.Now().After(d.numDeadline) {
+		if sel, ok := d.currentScreen().(NumberSelector); ok {
+			d.selectNumber(sel, false)
+		} else {
+			d.numInput = ""
+		}
+	}
+	d.checkIdle()
 	d.display(true)
 }
 
+// wake register activity and turn on display turned off by inactivity or
+// night mode. With `always` false (playback start, commands) display is not
+// turned on in night. Return true when display was turned on.
+func (d *ScreenMgr) wake(always bool) bool {
+	d.lastActivity = time.Now()
+	if !d.idleOff || (!always && isNightTime(d.lastActivity)) {
+		return false
+	}
+	screenLog.Debugf("ScreenMgr.wake: turning on display")
+	d.idleOff = false
+	d.disp.SetBacklight(true)
+	return true
+}
+
+// checkIdle turn off display at start of night mode and after configured time
+// of inactivity; in night display turned on by key is turned off after
+// idle timeout or defaultNightIdleTimeout
+func (d *ScreenMgr) checkIdle() {
+	now := time.Now()
+	night := isNightTime(now)
+	if !night {
+		d.night = false
+	} else if !d.night && !d.ums.HasMessages() {
+		d.night = true
+		if !d.idleOff && d.disp.Active() {
+			screenLog.Debugf("ScreenMgr.checkIdle: night mode started")
+			d.turnOff()
+		}
+		return
+	}
+
+	if d.idleOff || !d.disp.Active() {
+		return
+	}
+	timeout := time.Duration(configuration.DisplayConf.IdleTimeout) * time.Minute
+	if night && timeout <= 0 {
+		timeout = defaultNightIdleTimeout
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	if d.ums.HasMessages() || (d.playing && !night) {
+		d.lastActivity = now
+		return
+	}
+
+	if now.Sub(d.lastActivity) < timeout {
+		return
+	}
+
+	screenLog.Debugf("ScreenMgr.checkIdle: turning off display")
+	d.turnOff()
+}
+
+// turnOff turn off backlight until next activity
+func (d *ScreenMgr) turnOff() {
+	d.idleOff = true
+	d.screens = nil
+	d.disp.SetBacklight(false)
+}
+
 func (d *ScreenMgr) WebHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Write([]byte(d.lastContent))
 }
+
+// isNightTime check is `t` in night mode period defined in configuration
+func isNightTime(t time.Time) bool {
+	dc := &configuration.DisplayConf
+	if !dc.nightMode {
+		return false
+	}
+	start, end := dc.nightStart, dc.nightEnd
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return now >= start && now < end
+	}
+	// over midnight
+	return now >= start || now < end
+}
+
+// parseDayTime parse "HH:MM" into minutes since midnight
+func parseDayTime(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s': %v", value, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,354 @@
+package main
+
+// Lua scripts implementing screens
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	defaultScriptsReload = 2
+	// scriptCallTimeout limit time of one call of script function
+	scriptCallTimeout = 500 * time.Millisecond
+)
+
+// Script is loaded lua script; script is reloaded when file changed
+type Script struct {
+	Name    string
+	path    string
+	modTime time.Time
+	state   *lua.LState
+	err     error
+}
+
+// load (re)create lua state and run script
+func (s *Script) load(api map[string]lua.LGFunction) {
+	if s.state != nil {
+		s.state.Close()
+		s.state = nil
+	}
+	if st, err := os.Stat(s.path); err == nil {
+		s.modTime = st.ModTime()
+	}
+
+	L := lua.NewState()
+	mod := L.SetFuncs(L.NewTable(), api)
+	keys := L.NewTable()
+	keys.RawSetString("up", lua.LString(configuration.Keys.Menu.Up))
+	keys.RawSetString("down", lua.LString(configuration.Keys.Menu.Down))
+	keys.RawSetString("left", lua.LString(configuration.Keys.Menu.Left))
+	keys.RawSetString("right", lua.LString(configuration.Keys.Menu.Right))
+	keys.RawSetString("select", lua.LString(configuration.Keys.Menu.Select))
+	keys.RawSetString("back", lua.LString(configuration.Keys.Menu.Back))
+	mod.RawSetString("keys", keys)
+	mod.RawSetString("width", lua.LNumber(lcdWidth))
+	mod.RawSetString("height", lua.LNumber(lcdHeight))
+	L.SetGlobal("rpilcd", mod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptCallTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	s.err = L.DoFile(s.path)
+	L.RemoveContext()
+	if s.err != nil {
+		logger.Errorf("Script %s load error: %v", s.Name, s.err)
+		L.Close()
+		return
+	}
+	s.state = L
+	logger.Infof("Script %s loaded", s.Name)
+}
+
+// call global function `name` with `args`; return first result; nil when
+// function is not defined
+func (s *Script) call(name string, args ...lua.LValue) (lua.LValue, error) {
+	if s.state == nil {
+		return lua.LNil, s.err
+	}
+	fn := s.state.GetGlobal(name)
+	if fn.Type() != lua.LTFunction {
+		return lua.LNil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptCallTimeout)
+	defer cancel()
+	s.state.SetContext(ctx)
+	defer s.state.RemoveContext()
+	if err := s.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		logger.Errorf("Script %s %s error: %v", s.Name, name, err)
+		return lua.LNil, err
+	}
+	res := s.state.Get(-1)
+	s.state.Pop(1)
+	return res, nil
+}
+
+// Scripts manage scripts from configured directory
+type Scripts struct {
+	// Message send urgent messages from scripts
+	Message chan string
+
+	scripts   map[string]*Script
+	status    PlayerStatus
+	lastCheck time.Time
+}
+
+var scripts *Scripts
+
+// NewScripts create scripts manager; scripts are loaded on first use
+func NewScripts() *Scripts {
+	return &Scripts{
+		Message: make(chan string, 5),
+		scripts: make(map[string]*Script),
+	}
+}
+
+// Names return names of scripts available in scripts directory
+func (s *Scripts) Names() (names []string) {
+	dir := configuration.ScriptsConf.Dir
+	if dir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Errorf("Scripts.Names read dir error: %v", err)
+		return nil
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".lua") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".lua"))
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// Get return script `name`; load it when necessary
+func (s *Scripts) Get(name string) *Script {
+	if sc, ok := s.scripts[name]; ok {
+		return sc
+	}
+	sc := &Script{
+		Name: name,
+		path: filepath.Join(configuration.ScriptsConf.Dir, filepath.Base(name)+".lua"),
+	}
+	if configuration.ScriptsConf.Dir == "" {
+		sc.err = errors.New("scripts dir not configured")
+	} else {
+		sc.load(s.api())
+	}
+	s.scripts[name] = sc
+	return sc
+}
+
+// Tick reload changed scripts
+func (s *Scripts) Tick(now time.Time) {
+	interval := configuration.ScriptsConf.ReloadInterval
+	if interval == 0 {
+		interval = defaultScriptsReload
+	}
+	if interval < 0 || now.Sub(s.lastCheck) < time.Duration(interval)*time.Second {
+		return
+	}
+	s.lastCheck = now
+	for _, sc := range s.scripts {
+		st, err := os.Stat(sc.path)
+		if err != nil || st.ModTime().Equal(sc.modTime) {
+			continue
+		}
+		logger.Infof("Scripts: reloading %s", sc.Name)
+		sc.load(s.api())
+	}
+}
+
+// UpdatePlayerStatus remember status returned to scripts
+func (s *Scripts) UpdatePlayerStatus(st *PlayerStatus) {
+	if st != nil {
+		s.status = *st
+	}
+}
+
+// Close all scripts
+func (s *Scripts) Close() {
+	for _, sc := range s.scripts {
+		if sc.state != nil {
+			sc.state.Close()
+		}
+	}
+}
+
+// api return functions of "rpilcd" lua module
+func (s *Scripts) api() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"status": func(L *lua.LState) int {
+			st := &s.status
+			t := L.NewTable()
+			t.RawSetString("state", lua.LString(st.Status))
+			t.RawSetString("volume", lua.LString(st.Volume))
+			t.RawSetString("flags", lua.LString(st.Flags))
+			t.RawSetString("song", lua.LString(st.CurrentSong))
+			t.RawSetString("title", lua.LString(st.Title))
+			t.RawSetString("artist", lua.LString(st.Artist))
+			t.RawSetString("album", lua.LString(st.Album))
+			t.RawSetString("file", lua.LString(st.File))
+			t.RawSetString("station", lua.LString(st.StationName))
+			t.RawSetString("error", lua.LString(st.Error))
+			t.RawSetString("elapsed", lua.LNumber(st.Elapsed))
+			t.RawSetString("duration", lua.LNumber(st.Duration))
+			t.RawSetString("stream", lua.LBool(st.Stream))
+			L.Push(t)
+			return 1
+		},
+		"play": func(L *lua.LState) int {
+			player.Play(L.OptInt(1, -1))
+			return 0
+		},
+		"stop":  func(L *lua.LState) int { player.Stop(); return 0 },
+		"pause": func(L *lua.LState) int { player.Pause(); return 0 },
+		"next":  func(L *lua.LState) int { player.Next(); return 0 },
+		"prev":  func(L *lua.LState) int { player.Prev(); return 0 },
+		"volume": func(L *lua.LState) int {
+			if L.GetTop() > 0 {
+				vol := L.CheckInt(1)
+				// volume not available (ie. no mixer)
+				if player.Volume() < 0 {
+					return 0
+				}
+				if vol > 100 {
+					vol = 100
+				} else if vol < 0 {
+					vol = 0
+				}
+				player.SetVolume(vol)
+				return 0
+			}
+			L.Push(lua.LNumber(player.Volume()))
+			return 1
+		},
+		"playlist": func(L *lua.LState) int {
+			player.PlayPlaylist(L.CheckString(1))
+			return 0
+		},
+		"playlists": func(L *lua.LState) int {
+			t := L.NewTable()
+			for _, pl := range player.Playlists() {
+				t.Append(lua.LString(pl))
+			}
+			L.Push(t)
+			return 1
+		},
+		"mpd": func(L *lua.LState) int {
+			if _, ok := player.(*MPD); !ok {
+				L.Push(lua.LNil)
+				L.Push(lua.LString("player is not mpd"))
+				return 2
+			}
+			var args []string
+			for i := 2; i <= L.GetTop(); i++ {
+				args = append(args, L.CheckString(i))
+			}
+			if err := MPDCommand(L.CheckString(1), args...); err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(lua.LTrue)
+			return 1
+		},
+		"macro": func(L *lua.LState) int {
+			if err := macros.Run(L.CheckString(1)); err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(lua.LTrue)
+			return 1
+		},
+		"msg": func(L *lua.LState) int {
+			select {
+			case s.Message <- L.CheckString(1):
+			default:
+				logger.Error("Scripts: message queue full")
+			}
+			return 0
+		},
+		"log": func(L *lua.LState) int {
+			logger.Info("Script: ", L.CheckString(1))
+			return 0
+		},
+	}
+}
+
+// ScriptScreen show content rendered by script; script define functions
+// show() returning lines (table or string) and optionally action(key)
+// returning "ok", "back", "exit" or nothing
+type ScriptScreen struct {
+	script *Script
+}
+
+// NewScriptScreen create screen for script `name`
+func NewScriptScreen(name string) *ScriptScreen {
+	return &ScriptScreen{script: scripts.Get(name)}
+}
+
+func (s *ScriptScreen) Show() (res []string, fixPart int) {
+	value, err := s.script.call("show")
+	if err != nil {
+		// skip stack traceback
+		res = []string{"Script error", strings.SplitN(err.Error(), "\n", 2)[0]}
+	} else {
+		switch v := value.(type) {
+		case *lua.LTable:
+			for i := 1; i <= v.Len(); i++ {
+				res = append(res, lua.LVAsString(v.RawGetInt(i)))
+			}
+		case lua.LString:
+			res = strings.Split(string(v), "\n")
+		}
+	}
+	for len(res) < lcdHeight {
+		res = append(res, "")
+	}
+	return
+}
+
+func (s *ScriptScreen) Action(action string) (result int, screen Screen) {
+	value, _ := s.script.call("action", lua.LString(action))
+	switch lua.LVAsString(value) {
+	case "ok":
+		return ActionResultOk, nil
+	case "back":
+		return ActionResultBack, nil
+	case "exit":
+		return ActionResultExit, nil
+	}
+	if action == configuration.Keys.Menu.Back {
+		return ActionResultBack, nil
+	}
+	return ActionResultOk, nil
+}
+
+func (s *ScriptScreen) Valid() bool {
+	return true
+}
+
+// scriptsMenu create list of available scripts
+func scriptsMenu() Screen {
+	names := scripts.Names()
+	return &ListScreen{
+		Source: StringsSource(names),
+		Empty:  "No scripts",
+		OnSelect: func(idx int) (int, Screen) {
+			return ActionResultOk, NewScriptScreen(names[idx])
+		},
+	}
+}
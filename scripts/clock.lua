@@ -0,0 +1,31 @@
+-- Clock and current song; up/down change volume, select toggle pause.
+-- Functions of "rpilcd" module: status(), play([pos]), stop(), pause(),
+-- next(), prev(), volume([value]), playlist(name), playlists(), mpd(cmd, ...),
+-- macro(name), msg(text), log(text); rpilcd.keys contain menu keys.
+
+local seconds = true
+
+function show()
+	local st = rpilcd.status()
+	local fmt = seconds and "%H:%M:%S" or "%H:%M"
+	local song = st.title ~= "" and st.title or st.song
+	if st.state ~= "play" then
+		song = st.state
+	end
+	return {os.date(fmt) .. "  v" .. st.volume, song}
+end
+
+function action(key)
+	if key == rpilcd.keys.up then
+		rpilcd.volume(rpilcd.volume() + 5)
+	elseif key == rpilcd.keys.down then
+		rpilcd.volume(rpilcd.volume() - 5)
+	elseif key == rpilcd.keys.select then
+		rpilcd.pause()
+	elseif key == rpilcd.keys.right then
+		seconds = not seconds
+	else
+		return
+	end
+	return "ok"
+end
@@ -0,0 +1,111 @@
+package main
+
+// Access control for network services
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseAllowedIPs parse list of addresses and networks (CIDR)
+func parseAllowedIPs(list []string) (nets []*net.IPNet) {
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			logger.Errorf("parseAllowedIPs: invalid address '%s': %v", item, err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+// ipAllowed check is `remoteAddr` ("host:port") on `allowed` list; empty
+// list allow all
+func ipAllowed(remoteAddr string, allowed []*net.IPNet) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// httpAuth wrap `h` with ip allowlist and basic / bearer token authentication
+// configured in [services]
+func httpAuth(h http.Handler) http.Handler {
+	conf := configuration.ServicesConf
+	allowed := parseAllowedIPs(conf.AllowedIPs)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ipAllowed(r.RemoteAddr, allowed) {
+			logger.Infof("http: access denied for %s", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if conf.HTTPUser == "" && conf.HTTPToken == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if conf.HTTPToken != "" {
+			auth := r.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "Bearer ") &&
+				secureCompare(strings.TrimPrefix(auth, "Bearer "), conf.HTTPToken) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if conf.HTTPUser != "" {
+			if user, pass, ok := r.BasicAuth(); ok &&
+				secureCompare(user, conf.HTTPUser) && secureCompare(pass, conf.HTTPPassword) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="rpilcd"`)
+		}
+		logger.Infof("http: unauthorized request from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// tlsConfig load configured certificate; return nil when tls is not
+// configured
+func tlsConfig() (*tls.Config, error) {
+	conf := configuration.ServicesConf
+	if conf.TLSCert == "" || conf.TLSKey == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -1,13 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"crypto/tls"
+	"io"
 	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// umReadTimeout limit time for tls handshake and first line of message
+	umReadTimeout = 10 * time.Second
+	// umNextLineTimeout is time of waiting for next line of message
+	umNextLineTimeout = 500 * time.Millisecond
+	umMaxMsgSize      = 4096
 )
 
 // UMServer is local tcp service listening for urgent messages
 type UMServer struct {
 	Addr    string
 	Message chan string
+	// TLS enable encrypted connections when not nil
+	TLS *tls.Config
+	// Token, when set, must be send in first line of message
+	Token string
+	// Allowed is list of networks allowed to connect; empty allow all
+	Allowed []*net.IPNet
 }
 
 // Start local tcp service
@@ -26,6 +45,9 @@ func (s *UMServer) Start() {
 			logger.Error("UMServer.Start Listen error: ", err.Error())
 			return
 		}
+		if s.TLS != nil {
+			ln = tls.NewListener(ln, s.TLS)
+		}
 		defer func() {
 			if ln != nil {
 				ln.Close()
@@ -37,11 +59,53 @@ func (s *UMServer) Start() {
 				logger.Error("UMServer.Start Error accepting: ", err.Error())
 				return
 			}
-			buf := make([]byte, 1024)
-			if reqLen, err := conn.Read(buf); err == nil || reqLen > 0 {
-				s.Message <- string(buf[:reqLen])
+			if !ipAllowed(conn.RemoteAddr().String(), s.Allowed) {
+				logger.Infof("UMServer: access denied for %s", conn.RemoteAddr())
+				conn.Close()
+				continue
 			}
-			conn.Close()
+			go s.handle(conn)
 		}
 	}()
 }
+
+// handle read message from `conn`; message end on connection close or when
+// no next line arrive in umNextLineTimeout
+func (s *UMServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(umReadTimeout))
+	reader := bufio.NewReader(io.LimitReader(conn, umMaxMsgSize))
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(umNextLineTimeout))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	if msg, ok := s.checkToken(strings.Join(lines, "\n")); ok {
+		s.Message <- msg
+	} else {
+		logger.Infof("UMServer: invalid token from %s", conn.RemoteAddr())
+	}
+}
+
+// checkToken verify and strip token from first line of `msg`
+func (s *UMServer) checkToken(msg string) (string, bool) {
+	if s.Token == "" {
+		return msg, true
+	}
+	parts := strings.SplitN(msg, "\n", 2)
+	if len(parts) < 2 || !secureCompare(strings.TrimSpace(parts[0]), s.Token) {
+		return "", false
+	}
+	return parts[1], true
+}
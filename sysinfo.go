@@ -0,0 +1,393 @@
+package main
+
+// System statistics read from /proc and /sys
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type cpuSample struct {
+	name  string
+	idle  uint64
+	total uint64
+}
+
+func readCPUSamples() (res []cpuSample, err error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		s := cpuSample{name: fields[0]}
+		for i, v := range fields[1:] {
+			// guest and guest_nice are already counted in user and nice
+			if i >= 8 {
+				break
+			}
+			val, _ := strconv.ParseUint(v, 10, 64)
+			s.total += val
+			// idle + iowait
+			if i == 3 || i == 4 {
+				s.idle += val
+			}
+		}
+		res = append(res, s)
+	}
+	return res, scanner.Err()
+}
+
+// cpuUsage return lines with cpu usage (total and per core) since `prev` sample
+func cpuUsage(prev []cpuSample) (lines []string, curr []cpuSample) {
+	curr, err := readCPUSamples()
+	if err != nil {
+		logger.Errorf("sysinfo.cpuUsage error: %v", err)
+		return []string{"cpu: error"}, prev
+	}
+	for i, c := range curr {
+		usage := 0
+		if i < len(prev) && prev[i].name == c.name {
+			total := c.total - prev[i].total
+			if total > 0 {
+				usage = int(100 * (total - (c.idle - prev[i].idle)) / total)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%-5s %3d%%", c.name, usage))
+	}
+	return
+}
+
+// temperatures return temperature of each thermal zone
+func temperatures() (lines []string) {
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	for _, zone := range zones {
+		data, err := ioutil.ReadFile(filepath.Join(zone, "temp"))
+		if err != nil {
+			logger.Errorf("sysinfo.temperatures read %s error: %v", zone, err)
+			continue
+		}
+		temp, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.Base(zone), "thermal_")
+		if data, err := ioutil.ReadFile(filepath.Join(zone, "type")); err == nil {
+			name = strings.TrimSpace(string(data))
+		}
+		lines = append(lines, fmt.Sprintf("%s %.1fC", name, float64(temp)/1000))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "temp: n/a")
+	}
+	return
+}
+
+// CPUTemperature return temperature of first thermal zone in Celsius degrees
+func CPUTemperature() (float64, error) {
+	data, err := ioutil.ReadFile("/sys/class/thermal/thermal_zone0/temp")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, err
+	}
+	return float64(temp) / 1000, nil
+}
+
+func readMemInfo() (map[string]uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		val, _ := strconv.ParseUint(fields[1], 10, 64)
+		res[strings.TrimSuffix(fields[0], ":")] = val
+	}
+	return res, scanner.Err()
+}
+
+// memUsage return memory and swap usage
+func memUsage() []string {
+	mi, err := readMemInfo()
+	if err != nil {
+		logger.Errorf("sysinfo.memUsage error: %v", err)
+		return []string{"mem: error"}
+	}
+	memUsed := mi["MemTotal"] - mi["MemAvailable"]
+	swapUsed := mi["SwapTotal"] - mi["SwapFree"]
+	return []string{
+		fmt.Sprintf("mem %s/%s", formatSize(memUsed*1024), formatSize(mi["MemTotal"]*1024)),
+		fmt.Sprintf("swap %s/%s", formatSize(swapUsed*1024), formatSize(mi["SwapTotal"]*1024)),
+	}
+}
+
+// mountPoints return list of mount points of block devices
+func mountPoints() (res []string) {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		logger.Errorf("sysinfo.mountPoints error: %v", err)
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		res = append(res, fields[1])
+	}
+	return
+}
+
+// DiskUsage return used space in percent for `path`
+func DiskUsage(path string) (used int, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+	total := st.Blocks * uint64(st.Bsize)
+	free = st.Bavail * uint64(st.Bsize)
+	if total > 0 {
+		used = int(100 * (total - st.Bfree*uint64(st.Bsize)) / total)
+	}
+	return
+}
+
+// diskUsage return usage of all mounted block devices
+func diskUsage() (lines []string) {
+	for _, mp := range mountPoints() {
+		used, free, err := DiskUsage(mp)
+		if err != nil {
+			logger.Errorf("sysinfo.diskUsage %s error: %v", mp, err)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %d%% %s", mp, used, formatSize(free)))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "disk: n/a")
+	}
+	return
+}
+
+type netSample struct {
+	rx, tx uint64
+	ts     time.Time
+}
+
+func readNetDev() (map[string]netSample, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	res := make(map[string]netSample)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			continue
+		}
+		fields := strings.Fields(line[idx+1:])
+		if len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		res[strings.TrimSpace(line[:idx])] = netSample{rx, tx, now}
+	}
+	return res, scanner.Err()
+}
+
+// netUsage return address and throughput of each active interface since `prev`
+func netUsage(prev map[string]netSample) (lines []string, curr map[string]netSample) {
+	curr, err := readNetDev()
+	if err != nil {
+		logger.Errorf("sysinfo.netUsage error: %v", err)
+		return []string{"net: error"}, prev
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logger.Errorf("sysinfo.netUsage interfaces error: %v", err)
+		return []string{"net: error"}, prev
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addr := "-"
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, a := range addrs {
+				if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+					addr = ipnet.IP.String()
+					break
+				}
+			}
+		}
+		lines = append(lines, iface.Name+" "+addr)
+		c, ok := curr[iface.Name]
+		p, pok := prev[iface.Name]
+		if ok && pok {
+			dur := c.ts.Sub(p.ts).Seconds()
+			if dur > 0 {
+				lines = append(lines, fmt.Sprintf(" %s/%s",
+					formatSize(uint64(float64(c.rx-p.rx)/dur)),
+					formatSize(uint64(float64(c.tx-p.tx)/dur))))
+				continue
+			}
+		}
+		lines = append(lines, " -/-")
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "net: no iface")
+	}
+	return
+}
+
+// uptime return system uptime and load
+func uptime() []string {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		logger.Errorf("sysinfo.uptime error: %v", err)
+		return []string{"uptime: error"}
+	}
+	var secs float64
+	if fields := strings.Fields(string(data)); len(fields) > 0 {
+		secs, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	up := time.Duration(secs) * time.Second
+	days := int(up.Hours()) / 24
+	res := []string{
+		fmt.Sprintf("up %dd %02d:%02d", days, int(up.Hours())%24, int(up.Minutes())%60),
+	}
+	if data, err := ioutil.ReadFile("/proc/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) > 3 {
+			res = append(res, strings.Join(fields[:3], " "))
+		}
+	}
+	return res
+}
+
+func formatSize(size uint64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%dk", size>>10)
+	}
+	return strconv.FormatUint(size, 10)
+}
+
+// sysInfoInterval is interval between samples of system statistics
+const sysInfoInterval = 2 * time.Second
+
+// SysInfoScreen display live system statistics
+type SysInfoScreen struct {
+	kind    string
+	offset  int
+	lines   []string
+	cpu     []cpuSample
+	net     map[string]netSample
+	updated time.Time
+}
+
+// NewSysInfoScreen create screen for `kind` of statistics: cpu, temp, mem,
+// disk, net, uptime.
+func NewSysInfoScreen(kind string) *SysInfoScreen {
+	s := &SysInfoScreen{kind: kind}
+	// take first samples for delta-based statistics
+	s.update()
+	return s
+}
+
+func (s *SysInfoScreen) update() {
+	s.updated = time.Now()
+	switch s.kind {
+	case "cpu":
+		s.lines, s.cpu = cpuUsage(s.cpu)
+	case "temp":
+		s.lines = temperatures()
+	case "mem":
+		s.lines = memUsage()
+	case "disk":
+		s.lines = diskUsage()
+	case "net":
+		s.lines, s.net = netUsage(s.net)
+	case "uptime":
+		s.lines = uptime()
+	default:
+		s.lines = []string{"unknown: " + s.kind}
+	}
+}
+
+func (s *SysInfoScreen) Show() (res []string, fixPart int) {
+	if time.Since(s.updated) >= sysInfoInterval {
+		s.update()
+	}
+	if s.offset > len(s.lines)-lcdHeight {
+		s.offset = len(s.lines) - lcdHeight
+	}
+	if s.offset < 0 {
+		s.offset = 0
+	}
+	for i := s.offset; i < len(s.lines) && i < (s.offset+lcdHeight); i++ {
+		res = append(res, s.lines[i])
+	}
+	for len(res) < lcdHeight {
+		res = append(res, "")
+	}
+	return
+}
+
+func (s *SysInfoScreen) Action(action string) (result int, screen Screen) {
+	switch action {
+	case configuration.Keys.Menu.Up:
+		if s.offset > 0 {
+			s.offset--
+		}
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Down:
+		if s.offset+lcdHeight < len(s.lines) {
+			s.offset++
+		}
+		return ActionResultOk, nil
+	case configuration.Keys.Menu.Back:
+		return ActionResultBack, nil
+	}
+	return
+}
+
+func (s *SysInfoScreen) Valid() bool {
+	return true
+}
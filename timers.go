@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultSleepSteps = []int{15, 30, 60}
+
+// AlarmConf define one alarm
+type AlarmConf struct {
+	Label string
+	// Time of alarm in "HH:MM" format
+	Time string
+	// Days when alarm is active ("mon", "tue", ...); empty = every day
+	Days []string
+	// Playlist to load and play
+	Playlist string
+	// Volume target volume
+	Volume int
+	// Ramp is time in seconds of volume ramp-up
+	Ramp int
+}
+
+func (a *AlarmConf) key() string {
+	if a.Label != "" {
+		return a.Label
+	}
+	return a.Time
+}
+
+func (a *AlarmConf) activeOn(day time.Weekday) bool {
+	if len(a.Days) == 0 {
+		return true
+	}
+	wd := strings.ToLower(day.String()[:3])
+	for _, d := range a.Days {
+		d = strings.ToLower(d)
+		if len(d) > 3 {
+			d = d[:3]
+		}
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// timersState is persisted between restarts
+type timersState struct {
+	SleepDeadline  time.Time       `json:"sleep_deadline"`
+	AlarmsDisabled map[string]bool `json:"alarms_disabled"`
+}
+
+// Timers handle sleep timer and alarms
+type Timers struct {
+	state timersState
+
+	// fade out / ramp up in progress
+	fadeStart  time.Time
+	fadeVolume int
+	rampStart  time.Time
+	rampAlarm  *AlarmConf
+	lastAlarm  string
+}
+
+var timers *Timers
+
+// NewTimers create timers and load saved state
+func NewTimers() *Timers {
+	t := &Timers{}
+	t.load()
+	if t.state.AlarmsDisabled == nil {
+		t.state.AlarmsDisabled = make(map[string]bool)
+	}
+	if !t.state.SleepDeadline.IsZero() && t.state.SleepDeadline.Before(time.Now()) {
+		logger.Infof("Timers: sleep timer expired during restart")
+		t.state.SleepDeadline = time.Time{}
+	}
+	return t
+}
+
+// Reload create timers for new configuration; running sleep timer and volume
+// fade/ramp are kept
+func (t *Timers) Reload() *Timers {
+	n := NewTimers()
+	n.state.SleepDeadline = t.state.SleepDeadline
+	n.fadeStart, n.fadeVolume = t.fadeStart, t.fadeVolume
+	n.rampStart, n.rampAlarm = t.rampStart, t.rampAlarm
+	n.lastAlarm = t.lastAlarm
+	return n
+}
+
+func (t *Timers) load() {
+	fname := configuration.TimersConf.StateFile
+	if fname == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Timers.load error: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		logger.Errorf("Timers.load unmarshal error: %v", err)
+	}
+}
+
+func (t *Timers) save() {
+	fname := configuration.TimersConf.StateFile
+	if fname == "" {
+		return
+	}
+	data, err := json.Marshal(&t.state)
+	if err != nil {
+		logger.Errorf("Timers.save marshal error: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		logger.Errorf("Timers.save error: %v", err)
+	}
+}
+
+// SetSleep start sleep timer for `minutes`; 0 = disable
+func (t *Timers) SetSleep(minutes int) {
+	logger.Infof("Timers.SetSleep %d", minutes)
+	if minutes > 0 {
+		t.state.SleepDeadline = time.Now().Add(time.Duration(minutes) * time.Minute)
+	} else {
+		t.state.SleepDeadline = time.Time{}
+	}
+	t.fadeStart = time.Time{}
+	t.save()
+}
+
+// CycleSleep switch sleep timer to next configured step; return new value in minutes
+func (t *Timers) CycleSleep() int {
+	steps := configuration.TimersConf.SleepSteps
+	if len(steps) == 0 {
+		steps = defaultSleepSteps
+	}
+	next := steps[0]
+	if left := t.SleepLeft(); left > 0 {
+		next = 0
+		for _, s := range steps {
+			if time.Duration(s)*time.Minute > left+time.Minute {
+				next = s
+				break
+			}
+		}
+	}
+	t.SetSleep(next)
+	return next
+}
+
+// SleepLeft return time left to sleep; 0 = sleep timer not active
+func (t *Timers) SleepLeft() time.Duration {
+	if t.state.SleepDeadline.IsZero() {
+		return 0
+	}
+	if left := t.state.SleepDeadline.Sub(time.Now()); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// AlarmEnabled check is alarm enabled
+func (t *Timers) AlarmEnabled(a *AlarmConf) bool {
+	return !t.state.AlarmsDisabled[a.key()]
+}
+
+// ToggleAlarm enable/disable alarm
+func (t *Timers) ToggleAlarm(a *AlarmConf) {
+	key := a.key()
+	if t.state.AlarmsDisabled[key] {
+		delete(t.state.AlarmsDisabled, key)
+	} else {
+		t.state.AlarmsDisabled[key] = true
+	}
+	t.save()
+}
+
+// NextAlarm return time of nearest enabled alarm
+func (t *Timers) NextAlarm(now time.Time) (next time.Time) {
+	for _, a := range configuration.TimersConf.Alarms {
+		if !t.AlarmEnabled(a) {
+			continue
+		}
+		at, err := time.ParseInLocation("15:04", a.Time, now.Location())
+		if err != nil {
+			continue
+		}
+		for day := 0; day < 8; day++ {
+			d := now.AddDate(0, 0, day)
+			cand := time.Date(d.Year(), d.Month(), d.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+			if cand.After(now) && a.activeOn(cand.Weekday()) {
+				if next.IsZero() || cand.Before(next) {
+					next = cand
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+// Status return short info about active timers for status screen
+func (t *Timers) Status(playing bool) string {
+	if left := t.SleepLeft(); left > 0 {
+		return fmt.Sprintf("z%d", int(left.Minutes())+1)
+	}
+	if !playing {
+		if next := t.NextAlarm(time.Now()); !next.IsZero() && next.Sub(time.Now()) < 24*time.Hour {
+			return "A" + next.Format("15:04")
+		}
+	}
+	return ""
+}
+
+// Tick check timers and perform actions
+func (t *Timers) Tick() {
+	now := time.Now()
+	t.checkSleep(now)
+	t.checkAlarms(now)
+	t.rampUp(now)
+}
+
+func (t *Timers) checkSleep(now time.Time) {
+	if t.state.SleepDeadline.IsZero() || now.Before(t.state.SleepDeadline) {
+		return
+	}
+
+	fadeTime := time.Duration(configuration.TimersConf.FadeTime) * time.Second
+	fade := configuration.TimersConf.SleepMode == "fade" && fadeTime > 0
+	if fade && t.fadeStart.IsZero() {
+		// volume not available; stop without fading
+		if t.fadeVolume = player.Volume(); t.fadeVolume < 0 {
+			logger.Info("Timers: sleep - volume not available; skipping fade")
+			fade = false
+		}
+	}
+	if !fade {
+		logger.Info("Timers: sleep - stopping mpd")
+		player.Stop()
+		t.SetSleep(0)
+		return
+	}
+
+	if t.fadeStart.IsZero() {
+		logger.Info("Timers: sleep - fading out")
+		t.fadeStart = now
+		return
+	}
+
+	elapsed := now.Sub(t.fadeStart)
+	if elapsed >= fadeTime {
+		player.Stop()
+		// restore volume for next play
+		player.SetVolume(t.fadeVolume)
+		t.SetSleep(0)
+		return
+	}
+	player.SetVolume(t.fadeVolume - int(float64(t.fadeVolume)*elapsed.Seconds()/fadeTime.Seconds()))
+}
+
+func (t *Timers) checkAlarms(now time.Time) {
+	minute := now.Format("2006-01-02 15:04")
+	if minute == t.lastAlarm {
+		return
+	}
+	hm := now.Format("15:04")
+	for _, a := range configuration.TimersConf.Alarms {
+		if a.Time != hm || !a.activeOn(now.Weekday()) || !t.AlarmEnabled(a) {
+			continue
+		}
+		logger.Infof("Timers: alarm %s - playing %s", a.key(), a.Playlist)
+		t.lastAlarm = minute
+		if a.Ramp > 0 {
+			player.SetVolume(0)
+			t.rampStart = now
+			t.rampAlarm = a
+		} else if a.Volume > 0 {
+			player.SetVolume(a.Volume)
+		}
+		if a.Playlist != "" {
+			player.PlayPlaylist(a.Playlist)
+		} else {
+			player.Play(-1)
+		}
+		return
+	}
+}
+
+func (t *Timers) rampUp(now time.Time) {
+	if t.rampAlarm == nil {
+		return
+	}
+	a := t.rampAlarm
+	volume := a.Volume
+	if volume <= 0 {
+		volume = 100
+	}
+	ramp := time.Duration(a.Ramp) * time.Second
+	elapsed := now.Sub(t.rampStart)
+	if elapsed >= ramp {
+		player.SetVolume(volume)
+		t.rampAlarm = nil
+		return
+	}
+	player.SetVolume(int(float64(volume) * elapsed.Seconds() / ramp.Seconds()))
+}
+
+// alarmsMenu create list of all configured alarms; select toggle alarm
+func alarmsMenu() Screen {
+	alarms := configuration.TimersConf.Alarms
+	l := &ListScreen{Empty: "No alarms"}
+	l.Reload = func() {
+		var labels []string
+		for _, a := range alarms {
+			labels = append(labels, alarmLabel(a))
+		}
+		l.Source = StringsSource(labels)
+	}
+	l.OnSelect = func(idx int) (int, Screen) {
+		timers.ToggleAlarm(alarms[idx])
+		l.Reload()
+		return ActionResultOk, nil
+	}
+	l.Reload()
+	return l
+}
+
+func alarmLabel(a *AlarmConf) string {
+	state := "off"
+	if timers.AlarmEnabled(a) {
+		state = "on"
+	}
+	label := a.Time + " " + state
+	if a.Label != "" {
+		label += " " + a.Label
+	}
+	return label
+}
+
+func sleepLabel(minutes int) string {
+	if minutes > 0 {
+		return fmt.Sprintf("sleep %d min", minutes)
+	}
+	return "sleep off"
+}
+
+// executeTimer handle menu items of "timer" kind
+func (t *MenuItem) executeTimer() (result int, screen Screen) {
+	switch t.Cmd {
+	case "sleep":
+		minutes := 0
+		if len(t.Args) > 0 {
+			minutes, _ = strconv.Atoi(t.Args[0])
+		}
+		timers.SetSleep(minutes)
+		return ActionResultOk, &TextScreen{Lines: []string{sleepLabel(minutes)}, Timeout: 2}
+	case "alarms":
+		return ActionResultOk, alarmsMenu()
+	case "jobs":
+		return ActionResultOk, jobsMenu()
+	}
+	return ActionResultNop, nil
+}
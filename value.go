@@ -0,0 +1,257 @@
+package main
+
+// Value (slider) and toggle menu items
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	CharBarFull  = "\xff"
+	CharBarEmpty = "-"
+)
+
+// valueProperty is built-in property adjusted by "value" menu item
+type valueProperty struct {
+	min, max, step int
+	// get return current value; negative when not available
+	get func() int
+	set func(int)
+}
+
+var valueProperties = map[string]*valueProperty{
+	"volume": {0, 100, 5,
+		func() int { return player.Volume() },
+		func(v int) { player.SetVolume(v) },
+	},
+	"crossfade": {0, 30, 1,
+		func() int {
+			v, err := strconv.Atoi(MPDOption("xfade"))
+			if err != nil {
+				return -1
+			}
+			return v
+		},
+		MPDSetCrossfade,
+	},
+	"sleep": {0, 120, 5,
+		func() int { return int(timers.SleepLeft().Minutes() + 0.5) },
+		func(v int) { timers.SetSleep(v) },
+	},
+}
+
+// toggleProperty is built-in on/off option used by "toggle" menu item
+type toggleProperty struct {
+	get    func() bool
+	toggle func()
+}
+
+var toggleProperties = map[string]*toggleProperty{
+	"random":  {func() bool { return playerFlag("S") }, func() { player.ToggleRandom() }},
+	"repeat":  {func() bool { return playerFlag("R") }, func() { player.ToggleRepeat() }},
+	"consume": {func() bool { return playerFlag("C") }, playerToggleConsume},
+	"single":  {func() bool { return playerFlag("1") }, playerToggleSingle},
+}
+
+// playerToggleConsume toggle consume mode when supported by player
+func playerToggleConsume() {
+	if qm, ok := player.(QueueModes); ok {
+		qm.ToggleConsume()
+	}
+}
+
+// playerToggleSingle toggle single mode when supported by player
+func playerToggleSingle() {
+	if qm, ok := player.(QueueModes); ok {
+		qm.ToggleSingle()
+	}
+}
+
+// playerFlag check is `flag` set in player status flags
+func playerFlag(flag string) bool {
+	st := player.Status()
+	defer st.Free()
+	return strings.Contains(st.Flags, flag)
+}
+
+// runValueCmd run command `args` with "{value}" replaced by `value`
+func runValueCmd(args []string, value string) (string, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	var cmdArgs []string
+	for _, arg := range args[1:] {
+		cmdArgs = append(cmdArgs, strings.Replace(arg, "{value}", value, -1))
+	}
+	out, err := exec.Command(args[0], cmdArgs...).Output()
+	res := strings.TrimSpace(string(out))
+	if err != nil {
+		screenLog.Errorf("runValueCmd %v error: %v", args, err)
+	}
+	return res, err
+}
+
+// ValueScreen show value as horizontal bar; up/right increase value,
+// down/left decrease
+type ValueScreen struct {
+	Label          string
+	Min, Max, Step int
+	Set            func(int)
+
+	value int
+	// unavailable is set when current value can't be read; changes are
+	// ignored
+	unavailable bool
+}
+
+// NewValueScreen create slider for menu item of "value" kind
+func NewValueScreen(item *MenuItem) Screen {
+	v := &ValueScreen{
+		Label: item.Label,
+		Min:   item.Min,
+		Max:   item.Max,
+		Step:  item.Step,
+	}
+	if prop, ok := valueProperties[item.Cmd]; ok {
+		if v.Max == v.Min {
+			v.Min, v.Max = prop.min, prop.max
+		}
+		if v.Step == 0 {
+			v.Step = prop.step
+		}
+		v.value = prop.get()
+		v.unavailable = v.value < 0
+		v.Set = prop.set
+	} else if len(item.Get) > 0 {
+		out, err := runValueCmd(item.Get, "")
+		if err != nil {
+			return &TextScreen{Lines: []string{item.Label, "error"}, Timeout: 2}
+		}
+		v.unavailable = true
+		if fields := strings.Fields(out); len(fields) > 0 {
+			if val, err := strconv.Atoi(fields[0]); err == nil {
+				v.value, v.unavailable = val, false
+			}
+		}
+		v.Set = func(val int) {
+			runValueCmd(item.Set, strconv.Itoa(val))
+		}
+	} else {
+		screenLog.Errorf("NewValueScreen: unknown property '%s'", item.Cmd)
+		return &TextScreen{Lines: []string{item.Label, "unknown value"}, Timeout: 2}
+	}
+	if v.Max == v.Min {
+		v.Max = v.Min + 100
+	}
+	if v.Step <= 0 {
+		v.Step = 1
+	}
+	return v
+}
+
+func (v *ValueScreen) change(step int) {
+	if v.unavailable {
+		return
+	}
+	val := v.value + step
+	if val < v.Min {
+		val = v.Min
+	} else if val > v.Max {
+		val = v.Max
+	}
+	if val == v.value {
+		return
+	}
+	v.value = val
+	if v.Set != nil {
+		v.Set(val)
+	}
+}
+
+func (v *ValueScreen) Show() (res []string, fixPart int) {
+	if v.unavailable {
+		return []string{v.Label + ": n/a", ""}, 0
+	}
+	filled := (v.value - v.Min) * lcdWidth / (v.Max - v.Min)
+	if filled < 0 {
+		filled = 0
+	} else if filled > lcdWidth {
+		filled = lcdWidth
+	}
+	return []string{
+		v.Label + ": " + strconv.Itoa(v.value),
+		strings.Repeat(CharBarFull, filled) + strings.Repeat(CharBarEmpty, lcdWidth-filled),
+	}, 0
+}
+
+func (v *ValueScreen) Action(action string) (result int, screen Screen) {
+	switch action {
+	case configuration.Keys.Menu.Up, configuration.Keys.Menu.Right:
+		v.change(v.Step)
+	case configuration.Keys.Menu.Down, configuration.Keys.Menu.Left:
+		v.change(-v.Step)
+	case configuration.Keys.Menu.Up10:
+		v.change(10 * v.Step)
+	case configuration.Keys.Menu.Down10:
+		v.change(-10 * v.Step)
+	case configuration.Keys.Menu.Select, configuration.Keys.Menu.Back:
+		return ActionResultBack, nil
+	}
+	return ActionResultOk, nil
+}
+
+func (v *ValueScreen) Valid() bool {
+	return true
+}
+
+// toggleState return cached state of "toggle" item; read it when unknown
+func (t *MenuItem) toggleState() bool {
+	if t.stateRead {
+		return t.state
+	}
+	t.stateRead = true
+	if prop, ok := toggleProperties[t.Cmd]; ok {
+		t.state = prop.get()
+	} else if out, err := runValueCmd(t.Get, ""); err == nil {
+		switch strings.ToLower(out) {
+		case "1", "on", "yes", "true", "enabled":
+			t.state = true
+		default:
+			t.state = false
+		}
+	}
+	return t.state
+}
+
+// toggle switch state of "toggle" item
+func (t *MenuItem) toggle() (result int, screen Screen) {
+	newState := !t.toggleState()
+	if prop, ok := toggleProperties[t.Cmd]; ok {
+		prop.toggle()
+	} else if len(t.Set) > 0 {
+		if _, err := runValueCmd(t.Set, onOffLabels[newState]); err != nil {
+			return ActionResultOk, &TextScreen{Lines: []string{t.Label, "error"}, Timeout: 2}
+		}
+	} else {
+		return ActionResultNop, nil
+	}
+	t.stateRead = false
+	return ActionResultOk, nil
+}
+
+// refreshToggles force reading state of toggle items in submenu
+func (t *MenuItem) refreshToggles() {
+	for _, item := range t.Items {
+		item.stateRead = false
+	}
+}
+
+// displayLabel return label of menu item; toggle items show also state
+func (t *MenuItem) displayLabel() string {
+	if t.Kind == "toggle" {
+		return t.Label + ": " + onOffLabels[t.toggleState()]
+	}
+	return t.Label
+}